@@ -0,0 +1,51 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fairwindsops/astro/pkg/validate"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <files...>",
+	Short: "Validate configuration files",
+	Long:  "Validate ruleset configuration files, and the override annotations of Kubernetes manifests, without a cluster.  Exits non-zero if any problems are found.",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   validateFiles,
+}
+
+var customObjectTypes []string
+
+func init() {
+	validateCmd.Flags().StringSliceVar(&customObjectTypes, "astromonitorset-object-types", nil, "The group/version/kind object types AstroMonitorSets may use, as set by ASTROMONITORSET_OBJECT_TYPES.")
+	rootCmd.AddCommand(validateCmd)
+}
+
+func validateFiles(cmd *cobra.Command, files []string) {
+	errs := validate.Files(files, customObjectTypes)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if validate.HasErrors(errs) {
+		fmt.Fprintf(os.Stderr, "%d problems found\n", len(errs))
+		os.Exit(1)
+	}
+	fmt.Printf("%d files are valid\n", len(files))
+}
@@ -15,50 +15,113 @@
 package config
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ghodss/yaml"
 	log "github.com/sirupsen/logrus"
 	ddapi "github.com/zorkian/go-datadog-api"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/fairwindsops/astro/pkg/metrics"
 )
 
-type ruleset struct {
+// A Ruleset is the collection of rulesets astro manages monitors with.  Rulesets in use are never modified, so they can
+// be read while they are reloaded.
+type Ruleset struct {
 	ClusterVariables map[string]string `json:"cluster_variables,omitempty"`
 	MonitorSets      []MonitorSet      `json:"rulesets,omitempty"`
+
+	hash   string // A hash of the content of the rulesets, used to tell when a reload changes them
+	loaded bool   // Whether the rulesets from MonitorDefinitionsPath have been loaded
 }
 
 // A MonitorSet represents a collection of Monitors that applies to an object.
 type MonitorSet struct {
-	ObjectType   string                   `json:"type"`                    // The type of object.  Example: deployment
-	Annotations  []Annotation             `json:"match_annotations"`       // Annotations an object must possess to be considered applicable for the monitors.
-	BoundObjects []string                 `json:"bound_objects,omitempty"` // A collection of ObjectTypes that are bound to the MonitorSet.
-	Monitors     map[string]ddapi.Monitor `json:"monitors"`                // A collection of Monitors.
+	Name              string                            `json:"name,omitempty"`               // A name identifying the ruleset in the tags of its monitors.  Defaults to its type and position among rulesets of that type, eg deployment-0.
+	ObjectType        string                            `json:"type"`                         // The type of object.  Example: deployment
+	MatchAll          bool                              `json:"match_all,omitempty"`          // When true, the ruleset applies to every object of its type that isn't ignored, even without any rules.
+	Annotations       []Annotation                      `json:"match_annotations"`            // Annotations an object must possess to be considered applicable for the monitors.
+	Labels            map[string]string                 `json:"match_labels,omitempty"`       // Labels an object must possess to be considered applicable for the monitors.
+	Expressions       []metav1.LabelSelectorRequirement `json:"match_expressions,omitempty"`  // Label selector requirements an object must satisfy to be considered applicable for the monitors.
+	IncludeNamespaces []string                          `json:"namespaces,omitempty"`         // Patterns of namespace names the ruleset is limited to, eg preview-*.
+	ExcludeNamespaces []string                          `json:"exclude_namespaces,omitempty"` // Patterns of namespace names the ruleset doesn't apply to.
+	NamespaceSelector *metav1.LabelSelector             `json:"namespace_selector,omitempty"` // A selector the labels of an object's namespace must match.
+	BoundObjects      []string                          `json:"bound_objects,omitempty"`      // A collection of ObjectTypes that are bound to the MonitorSet.
+	Monitors          map[string]ddapi.Monitor          `json:"monitors"`                     // A collection of Monitors.
+	Synthetics        map[string]ddapi.SyntheticsTest   `json:"synthetics,omitempty"`         // A collection of Synthetics tests, used with ingress rulesets.
+	Namespace         string                            `json:"-"`                            // The namespace of the AstroMonitorSet the ruleset came from.  Only objects in this namespace match.
+
+	defaultName bool // Whether Name was defaulted from the position of the ruleset, which isn't part of its monitors' identity
 }
 
-// An Annotation represent a kubernetes annotation.
+// An Annotation represent a kubernetes annotation.  Without an operator, the annotation must have the value specified.
 type Annotation struct {
-	Name  string `json:"name"`  // The annotation name.
-	Value string `json:"value"` // The value of the annotation.
+	Name     string   `json:"name"`               // The annotation name.
+	Value    string   `json:"value,omitempty"`    // The value of the annotation.
+	Operator string   `json:"operator,omitempty"` // One of In, NotIn, Exists or DoesNotExist, as used in label selectors.
+	Values   []string `json:"values,omitempty"`   // The values used by the In and NotIn operators.
+}
+
+// matches returns whether the annotations of an object satisfy the Annotation.  The semantics of each operator match
+// those of label selectors, eg NotIn matches objects without the annotation.
+func (annotation Annotation) matches(annotations map[string]string) bool {
+	val, found := annotations[annotation.Name]
+	switch metav1.LabelSelectorOperator(annotation.Operator) {
+	case "":
+		return found && val == annotation.Value
+	case metav1.LabelSelectorOpIn:
+		return found && contains(annotation.Values, val)
+	case metav1.LabelSelectorOpNotIn:
+		return !found || !contains(annotation.Values, val)
+	case metav1.LabelSelectorOpExists:
+		return found
+	case metav1.LabelSelectorOpDoesNotExist:
+		return !found
+	}
+	return false
+}
+
+func (annotation Annotation) validate() error {
+	switch metav1.LabelSelectorOperator(annotation.Operator) {
+	case "", metav1.LabelSelectorOpExists, metav1.LabelSelectorOpDoesNotExist:
+	case metav1.LabelSelectorOpIn, metav1.LabelSelectorOpNotIn:
+		if len(annotation.Values) == 0 {
+			return fmt.Errorf("annotation %s: operator %s requires values", annotation.Name, annotation.Operator)
+		}
+	default:
+		return fmt.Errorf("annotation %s: unknown operator %s", annotation.Name, annotation.Operator)
+	}
+	return nil
 }
 
 // An Event represents an update of a Kubernetes object and contains metadata about the update.
 type Event struct {
-	EventType    string             // The type of event - update, delete, or create
+	EventType    string             // The type of event - update, delete, create, or resync when the rulesets change
 	Key          string             // A key identifying the object.  This is in the format <object-type>/<object-name>
 	Namespace    string             // The namespace of the event's object
 	OldMeta      *metav1.ObjectMeta // Metadata from old kubernetes object in update or delete events
 	NewMeta      *metav1.ObjectMeta // Metadata from new kubernetes object in update or add events
 	ResourceType string             // The type of resource that was updated.
+	Resync       bool               // Whether the object is reconciled again without having changed, such as when the rulesets change
 }
 
 // Config represents the application configuration.
@@ -68,8 +131,96 @@ type Config struct {
 	ClusterName            string   // A unique name for the cluster
 	OwnerTag               string   // A unique tag to identify the owner of monitors
 	MonitorDefinitionsPath []string // A url or local path for the configuration file
-	Rulesets               *ruleset // The collection of rulesets to manage
 	DryRun                 bool     // when set to true monitors will not be managed in datadog
+	NodePoolLabel          string   // The node label that identifies a node's pool.  When empty, well known pool labels are used.
+	MonitorRefreshInterval int      // The minutes between listing the monitors in Datadog again to refresh the index of managed monitors.
+	DatadogSite            string   // The Datadog site of the account, eg datadoghq.eu
+	DatadogAPIURL          string   // The url of the Datadog API, overriding the one of DatadogSite
+	DatadogProxyURL        string   // The url of a proxy for requests to Datadog.  When empty, the proxy environment variables are used.
+	DatadogCABundle        string   // The path of PEM certificates to trust for Datadog, in addition to the system's
+	DatadogTimeout         int      // The seconds to wait for Datadog to respond to a request
+	CustomObjectTypes      []string // The group/version/kind object types that rulesets from AstroMonitorSets may use
+
+	rulesets          atomic.Value // The *Ruleset in use, which is replaced rather than modified
+	rulesetMux        sync.Mutex
+	definedRulesets   *Ruleset              // The rulesets loaded from MonitorDefinitionsPath
+	customMonitorSets map[string]MonitorSet // The rulesets from AstroMonitorSets, keyed by namespace/name
+	changeListeners   []*func()             // Functions called when the content of the rulesets changes
+	reloadMux         sync.Mutex
+	urlSources        map[string]*urlSource // The content last fetched from each URL in MonitorDefinitionsPath
+}
+
+// A urlSource is the content fetched from a URL, with the validators used to fetch it again only if it has changed.
+type urlSource struct {
+	data         []byte
+	etag         string
+	lastModified string
+}
+
+// AstroMonitorSetObjectType is the group/version/kind of the AstroMonitorSet custom resource.
+const AstroMonitorSetObjectType = "astro.fairwinds.com/v1alpha1/AstroMonitorSet"
+
+// DefaultDatadogSite is the Datadog site of accounts in the US1 region.
+const DefaultDatadogSite = "datadoghq.com"
+
+// IgnoreAnnotation opts an object, or every object in a namespace, out of match_all rulesets when set to true.
+const IgnoreAnnotation = "astro.fairwinds.com/ignore"
+
+// The prefixes of the tags that identify a monitor, so it's found again in Datadog when its name changes.  A monitor
+// is identified by its ruleset, unless the ruleset is unnamed, its key in the ruleset, and the object it monitors.
+const (
+	RulesetTagPrefix    = "astro:ruleset:"
+	MonitorTagPrefix    = "astro:monitor:"
+	UIDTagPrefix        = "astro:uid:"
+	ObjectTypeTagPrefix = "astro:object_type:"
+	ResourceTagPrefix   = "astro:resource:"
+)
+
+// IdentityTagPrefixes are the prefixes of every tag that is part of a monitor's identity.
+var IdentityTagPrefixes = []string{RulesetTagPrefix, MonitorTagPrefix, UIDTagPrefix, ObjectTypeTagPrefix, ResourceTagPrefix}
+
+// The prefixes of the tags that identify a synthetics test along with its ruleset and ingress: its key in the
+// ruleset, and the host and path it tests.
+const (
+	SyntheticsTagPrefix = "astro:synthetics:"
+	HostTagPrefix       = "astro:host:"
+	PathTagPrefix       = "astro:path:"
+)
+
+// SyntheticsIdentityTagPrefixes are the prefixes of every tag that is part of a synthetics test's identity.
+var SyntheticsIdentityTagPrefixes = []string{RulesetTagPrefix, SyntheticsTagPrefix, HostTagPrefix, PathTagPrefix, ObjectTypeTagPrefix, ResourceTagPrefix}
+
+// invalidTagCharacters matches the characters Datadog replaces with an underscore in tags.
+var invalidTagCharacters = regexp.MustCompile(`[^a-z0-9_:./-]`)
+
+// TagValue returns value as Datadog stores it in a tag, in lower case with unsupported characters replaced.
+func TagValue(value string) string {
+	return invalidTagCharacters.ReplaceAllString(strings.ToLower(value), "_")
+}
+
+// BindableObjectTypes are the object types watched natively by astro that can be listed in a binding's bound_objects.
+// Objects watched through the dynamic client can also be bound using their group/version/kind.
+var BindableObjectTypes = []string{
+	"deployment",
+	"statefulset",
+	"daemonset",
+	"cronjob",
+	"job",
+	"service",
+	"horizontalpodautoscaler",
+	"persistentvolumeclaim",
+	"ingress",
+}
+
+// OverrideFields are the monitor fields that can be overridden with astro.fairwinds.com/override.<monitor>.<field>
+// annotations.
+var OverrideFields = []string{
+	"name",
+	"type",
+	"query",
+	"message",
+	"threshold-critical",
+	"threshold-warning",
 }
 
 // Override represents any datadog monitor fields annotations can be overridden
@@ -78,23 +229,39 @@ type Override struct {
 	Value string
 }
 
-// GetMatchingMonitors returns a collection of monitors that apply to the specified objectType and annotations.
-func (config *Config) GetMatchingMonitors(annotations map[string]string, objectType string, overrides map[string][]Override) *[]ddapi.Monitor {
-	var validMonitors []ddapi.Monitor
+// GetMatchingMonitors returns a collection of monitors that apply to the specified objectType, annotations and labels.
+// namespace is the namespace of the object, or nil for cluster scoped objects.  Namespaces are their own namespace.
+func (rSet *Ruleset) GetMatchingMonitors(annotations map[string]string, labels map[string]string, namespace *corev1.Namespace, objectType string, overrides map[string][]Override) *[]ddapi.Monitor {
+	return flattenMonitors(rSet.GetMatchingMonitorSets(annotations, labels, namespace, objectType, overrides))
+}
 
-	for _, mSet := range *config.getMatchingRulesets(annotations, objectType, overrides) {
+// GetMatchingMonitorSets returns the rulesets whose monitors GetMatchingMonitors returns, with overrides applied.
+func (rSet *Ruleset) GetMatchingMonitorSets(annotations map[string]string, labels map[string]string, namespace *corev1.Namespace, objectType string, overrides map[string][]Override) []MonitorSet {
+	return *rSet.getMatchingRulesets(annotations, labels, namespace, objectType, overrides)
+}
+
+// flattenMonitors returns the monitors of every MonitorSet in mSets.
+func flattenMonitors(mSets []MonitorSet) *[]ddapi.Monitor {
+	var monitors []ddapi.Monitor
+	for _, mSet := range mSets {
 		for _, v := range mSet.Monitors {
-			validMonitors = append(validMonitors, v)
+			monitors = append(monitors, v)
 		}
 	}
-	return &validMonitors
+	return &monitors
 }
 
 // GetStaticMonitors returns a collection of monitors from the config file that do not depend on resources in the kube cluster.
-func (config *Config) GetStaticMonitors() *[]ddapi.Monitor {
+func (rSet *Ruleset) GetStaticMonitors() *[]ddapi.Monitor {
 	var validMonitors []ddapi.Monitor
-	for _, monitorSet := range config.Rulesets.MonitorSets {
-		if monitorSet.ObjectType == "static" {
+	for _, monitorSet := range rSet.MonitorSets {
+		if monitorSet.ObjectType == "static" && monitorSet.Namespace == "" {
+			monitorSet, err := copyMonitorSet(monitorSet)
+			if err != nil {
+				log.Errorf("Error copying static monitors: %v", err)
+				continue
+			}
+			monitorSet.appendIdentityTags()
 			for _, v := range monitorSet.Monitors {
 				validMonitors = append(validMonitors, v)
 			}
@@ -103,92 +270,469 @@ func (config *Config) GetStaticMonitors() *[]ddapi.Monitor {
 	return &validMonitors
 }
 
-func (config *Config) getMatchingRulesets(annotations map[string]string, objectType string, overrides map[string][]Override) *[]MonitorSet {
+func (rSet *Ruleset) getMatchingRulesets(annotations map[string]string, labels map[string]string, namespace *corev1.Namespace, objectType string, overrides map[string][]Override) *[]MonitorSet {
 	var validMSets []MonitorSet
 
-	for monitorSetIdx, monitorSet := range config.Rulesets.MonitorSets {
+	for monitorSetIdx, monitorSet := range rSet.MonitorSets {
+		if !monitorSet.matchesNamespace(namespace) {
+			log.Debugf("Namespace does not match, so monitor %d does not match", monitorSetIdx)
+			continue
+		}
 		if monitorSet.ObjectType == objectType {
-			var hasAllAnnotations = false
+			if monitorSet.MatchAll && isIgnored(annotations, namespace) {
+				log.Debugf("Object is ignored, so monitor %d does not match", monitorSetIdx)
+				continue
+			}
+			// a ruleset must have at least one rule to match on, unless it matches everything.
+			var hasAllAnnotations = monitorSet.MatchAll || len(monitorSet.Annotations) > 0 || len(monitorSet.Labels) > 0 || len(monitorSet.Expressions) > 0
 
 			for _, annotation := range monitorSet.Annotations {
-				val, found := annotations[annotation.Name]
-				if found && val == annotation.Value {
-					hasAllAnnotations = true
-				} else {
+				if !annotation.matches(annotations) {
 					hasAllAnnotations = false
-					log.Debugf("Annotation %s with value %s does not exist, so monitor %d does not match", annotation.Name, annotation.Value, monitorSetIdx)
+					log.Debugf("Annotation %s does not match, so monitor %d does not match", annotation.Name, monitorSetIdx)
 					break
 				}
 			}
 
 			if hasAllAnnotations {
-				for name := range monitorSet.Monitors {
-					if _, exists := overrides[name]; exists {
-						tmpMonitor := monitorSet.Monitors[name]
-						tmpOverrides := overrides[name]
-						for i, o := range overrides[name] {
-							switch o.Field {
-							case "name":
-								tmpMonitor.Name = &tmpOverrides[i].Value
-							case "type":
-								tmpMonitor.Type = &tmpOverrides[i].Value
-							case "query":
-								tmpMonitor.Query = &tmpOverrides[i].Value
-							case "message":
-								tmpMonitor.Message = &tmpOverrides[i].Value
-							case "threshold-critical":
-								if tmpMonitor.Options == nil {
-									tmpMonitor.Options = &ddapi.Options{}
-								}
-								if tmpMonitor.Options.Thresholds == nil {
-									tmpMonitor.Options.Thresholds = &ddapi.ThresholdCount{}
-								}
-								if tmpOverrides[i].Value != "" {
-									threshold := json.Number(tmpOverrides[i].Value)
-									tmpMonitor.Options.Thresholds.Critical = &threshold
-								}
-							case "threshold-warning":
-								if tmpMonitor.Options == nil {
-									tmpMonitor.Options = &ddapi.Options{}
-								}
-								if tmpMonitor.Options.Thresholds == nil {
-									tmpMonitor.Options.Thresholds = &ddapi.ThresholdCount{}
-								}
-								if tmpOverrides[i].Value != "" {
-									threshold := json.Number(tmpOverrides[i].Value)
-									tmpMonitor.Options.Thresholds.Warning = &threshold
-								}
-							default:
-								log.Warnf("override provided does mot match any monitor fields. provided field: %s", o.Field)
-							}
-						}
-						monitorSet.Monitors[name] = tmpMonitor
-					} else {
-						config.reloadRulesets()
+				selector, err := monitorSet.labelSelector()
+				if err != nil {
+					hasAllAnnotations = false
+					log.Errorf("Invalid label selector in monitor %d: %v", monitorSetIdx, err)
+				} else if !selector.Matches(k8slabels.Set(labels)) {
+					hasAllAnnotations = false
+					log.Debugf("Labels do not match selector %s, so monitor %d does not match", selector, monitorSetIdx)
+				}
+			}
+
+			if hasAllAnnotations {
+				// the ruleset is shared by every reconcile, so overrides are applied to a copy of it.
+				matched, err := copyMonitorSet(monitorSet)
+				if err != nil {
+					log.Errorf("Error copying monitor %d: %v", monitorSetIdx, err)
+					continue
+				}
+				for name, monitor := range matched.Monitors {
+					if monitorOverrides, exists := overrides[name]; exists {
+						matched.Monitors[name] = applyOverrides(monitor, monitorOverrides)
 					}
 				}
-				validMSets = append(validMSets, monitorSet)
+				matched.appendIdentityTags()
+				validMSets = append(validMSets, matched)
 			}
 		}
 	}
 	return &validMSets
 }
 
+// applyOverrides returns monitor with the fields overridden by annotations replaced.
+func applyOverrides(monitor ddapi.Monitor, overrides []Override) ddapi.Monitor {
+	for i, o := range overrides {
+		switch o.Field {
+		case "name":
+			monitor.Name = &overrides[i].Value
+		case "type":
+			monitor.Type = &overrides[i].Value
+		case "query":
+			monitor.Query = &overrides[i].Value
+		case "message":
+			monitor.Message = &overrides[i].Value
+		case "threshold-critical":
+			if monitor.Options == nil {
+				monitor.Options = &ddapi.Options{}
+			}
+			if monitor.Options.Thresholds == nil {
+				monitor.Options.Thresholds = &ddapi.ThresholdCount{}
+			}
+			if overrides[i].Value != "" {
+				threshold := json.Number(overrides[i].Value)
+				monitor.Options.Thresholds.Critical = &threshold
+			}
+		case "threshold-warning":
+			if monitor.Options == nil {
+				monitor.Options = &ddapi.Options{}
+			}
+			if monitor.Options.Thresholds == nil {
+				monitor.Options.Thresholds = &ddapi.ThresholdCount{}
+			}
+			if overrides[i].Value != "" {
+				threshold := json.Number(overrides[i].Value)
+				monitor.Options.Thresholds.Warning = &threshold
+			}
+		default:
+			log.Warnf("override provided does mot match any monitor fields. provided field: %s", o.Field)
+		}
+	}
+	return monitor
+}
+
 // GetBoundMonitors returns a collection of monitors that are indirectly bound to objectTypes in the namespace specified.
-func (config *Config) GetBoundMonitors(nsAnnotations map[string]string, objectType string, overrides map[string][]Override) *[]ddapi.Monitor {
-	var linkedMonitors []ddapi.Monitor
-	mSets := config.getMatchingRulesets(nsAnnotations, "binding", overrides)
+func (rSet *Ruleset) GetBoundMonitors(namespace *corev1.Namespace, objectType string, overrides map[string][]Override) *[]ddapi.Monitor {
+	return flattenMonitors(rSet.GetBoundMonitorSets(namespace, objectType, overrides))
+}
+
+// GetBoundMonitorSets returns the binding rulesets whose monitors GetBoundMonitors returns.
+func (rSet *Ruleset) GetBoundMonitorSets(namespace *corev1.Namespace, objectType string, overrides map[string][]Override) []MonitorSet {
+	var linkedMSets []MonitorSet
+	mSets := rSet.getMatchingRulesets(namespace.Annotations, namespace.Labels, namespace, "binding", overrides)
 
 	for _, mSet := range *mSets {
 		if contains(mSet.BoundObjects, objectType) {
 			// object is linked to the ruleset
 			mSet.AppendTag("astro:bound_object")
-			for _, v := range mSet.Monitors {
-				linkedMonitors = append(linkedMonitors, v)
+			linkedMSets = append(linkedMSets, mSet)
+		}
+	}
+	return linkedMSets
+}
+
+// GetBoundObjectTypes returns every object type listed in the bound_objects of a binding ruleset.
+func (rSet *Ruleset) GetBoundObjectTypes() []string {
+	var objectTypes []string
+	for _, monitorSet := range rSet.MonitorSets {
+		for _, objectType := range monitorSet.BoundObjects {
+			if !contains(objectTypes, objectType) {
+				objectTypes = append(objectTypes, objectType)
+			}
+		}
+	}
+	return objectTypes
+}
+
+// GetNamespaceDependentObjectTypes returns the namespaced object types whose rulesets depend on their namespace.  These
+// are the types bound by binding rulesets, and types with rulesets that use a namespace_selector or match_all, which
+// can be opted out of through the namespace.
+func (rSet *Ruleset) GetNamespaceDependentObjectTypes() []string {
+	objectTypes := rSet.GetBoundObjectTypes()
+	for _, monitorSet := range rSet.MonitorSets {
+		if !monitorSet.MatchAll && monitorSet.NamespaceSelector == nil {
+			continue
+		}
+		_, generic := ParseObjectType(monitorSet.ObjectType)
+		if (generic || contains(BindableObjectTypes, monitorSet.ObjectType)) && !contains(objectTypes, monitorSet.ObjectType) {
+			objectTypes = append(objectTypes, monitorSet.ObjectType)
+		}
+	}
+	return objectTypes
+}
+
+// GetGenericObjectTypes returns the object types in the rulesets that are watched through the dynamic client.
+// This includes generic object types that are bound to a namespace.
+func (rSet *Ruleset) GetGenericObjectTypes() []string {
+	var objectTypes []string
+	for _, monitorSet := range rSet.MonitorSets {
+		for _, objectType := range append([]string{monitorSet.ObjectType}, monitorSet.BoundObjects...) {
+			if _, ok := ParseObjectType(objectType); ok && !contains(objectTypes, objectType) {
+				objectTypes = append(objectTypes, objectType)
+			}
+		}
+	}
+	return objectTypes
+}
+
+// ParseObjectType returns the GroupVersionKind of an object type written as group/version/kind, eg argoproj.io/v1alpha1/Rollout.
+// Kinds in the core group are written as version/kind, eg v1/Service.  ok is false for the object types astro
+// watches natively, such as deployment.
+func ParseObjectType(objectType string) (gvk schema.GroupVersionKind, ok bool) {
+	parts := strings.Split(objectType, "/")
+	switch len(parts) {
+	case 2:
+		gvk = schema.GroupVersionKind{Version: parts[0], Kind: parts[1]}
+	case 3:
+		gvk = schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}
+	default:
+		return gvk, false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return schema.GroupVersionKind{}, false
+		}
+	}
+	return gvk, true
+}
+
+// validate checks that a MonitorSet's match rules are valid, that it only binds object types that astro watches, and
+// that only ingress rulesets define synthetics tests.
+func (mSet *MonitorSet) validate() error {
+	for _, annotation := range mSet.Annotations {
+		if err := annotation.validate(); err != nil {
+			return err
+		}
+	}
+	if _, err := mSet.labelSelector(); err != nil {
+		return err
+	}
+	for _, pattern := range append(append([]string{}, mSet.IncludeNamespaces...), mSet.ExcludeNamespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("namespace pattern %q is invalid: %v", pattern, err)
+		}
+	}
+	if mSet.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(mSet.NamespaceSelector); err != nil {
+			return fmt.Errorf("namespace_selector is invalid: %v", err)
+		}
+	}
+	for _, objectType := range mSet.BoundObjects {
+		if _, ok := ParseObjectType(objectType); !ok && !contains(BindableObjectTypes, objectType) {
+			return fmt.Errorf("bound object type %q is not watched", objectType)
+		}
+	}
+	if len(mSet.Synthetics) > 0 && mSet.ObjectType != "ingress" {
+		// synthetics tests are templated against the hosts and paths of an ingress, so bindings can't apply them.
+		return errors.New("synthetics tests can only be defined in ingress rulesets")
+	}
+	return nil
+}
+
+// matchesNamespace returns whether a MonitorSet applies to objects in namespace.  namespace is nil for cluster scoped
+// objects, which only match rulesets that aren't limited to particular namespaces.
+func (mSet *MonitorSet) matchesNamespace(namespace *corev1.Namespace) bool {
+	if namespace == nil {
+		return mSet.Namespace == "" && len(mSet.IncludeNamespaces) == 0 && mSet.NamespaceSelector == nil
+	}
+	if mSet.Namespace != "" && mSet.Namespace != namespace.Name {
+		// rulesets from an AstroMonitorSet only apply to objects in its namespace.
+		return false
+	}
+	if len(mSet.IncludeNamespaces) > 0 && !matchesAnyPattern(mSet.IncludeNamespaces, namespace.Name) {
+		return false
+	}
+	if matchesAnyPattern(mSet.ExcludeNamespaces, namespace.Name) {
+		return false
+	}
+	if mSet.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(mSet.NamespaceSelector)
+		if err != nil {
+			log.Errorf("Invalid namespace selector: %v", err)
+			return false
+		}
+		return selector.Matches(k8slabels.Set(namespace.Labels))
+	}
+	return true
+}
+
+// isIgnored returns whether an object with the annotations specified has opted out of match_all rulesets, either
+// itself or through its namespace.
+func isIgnored(annotations map[string]string, namespace *corev1.Namespace) bool {
+	if ignored, _ := strconv.ParseBool(annotations[IgnoreAnnotation]); ignored {
+		return true
+	}
+	if namespace != nil {
+		ignored, _ := strconv.ParseBool(namespace.Annotations[IgnoreAnnotation])
+		return ignored
+	}
+	return false
+}
+
+// matchesAnyPattern returns whether name matches any of the shell patterns, as used by path.Match.
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// labelSelector returns the selector formed by a MonitorSet's match_labels and match_expressions.
+func (mSet *MonitorSet) labelSelector() (k8slabels.Selector, error) {
+	return metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels:      mSet.Labels,
+		MatchExpressions: mSet.Expressions,
+	})
+}
+
+// IsKnownObjectType returns whether objectType can be used as the type of a ruleset.
+func IsKnownObjectType(objectType string) bool {
+	switch objectType {
+	case "static", "node", "namespace", "binding":
+		return true
+	}
+	if _, ok := ParseObjectType(objectType); ok {
+		return true
+	}
+	return contains(BindableObjectTypes, objectType)
+}
+
+// Validate checks that a MonitorSet has a known type and that its match rules are valid.
+func (mSet *MonitorSet) Validate() []error {
+	var errs []error
+	if mSet.ObjectType == "" {
+		errs = append(errs, errors.New("type is required"))
+	} else if !IsKnownObjectType(mSet.ObjectType) {
+		errs = append(errs, fmt.Errorf("type %s is not a known object type", mSet.ObjectType))
+	}
+	if err := mSet.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ValidateCustom checks that a MonitorSet from an AstroMonitorSet is valid.  These rulesets are scoped to a namespace,
+// so they can't manage static monitors or monitors for cluster scoped objects.  The group/version/kind types they
+// match or bind must be listed in allowedObjectTypes and be namespaced, as told by isNamespaced.  The scope of types
+// isn't checked when isNamespaced is nil.
+func (mSet *MonitorSet) ValidateCustom(allowedObjectTypes []string, isNamespaced func(gvk schema.GroupVersionKind) (bool, error)) []error {
+	errs := mSet.Validate()
+	if mSet.ObjectType == "static" || mSet.ObjectType == "node" {
+		errs = append(errs, fmt.Errorf("type %s can't be used in an AstroMonitorSet", mSet.ObjectType))
+	}
+	for _, objectType := range append([]string{mSet.ObjectType}, mSet.BoundObjects...) {
+		gvk, ok := ParseObjectType(objectType)
+		if !ok {
+			continue
+		}
+		if !contains(allowedObjectTypes, objectType) {
+			errs = append(errs, fmt.Errorf("type %s is not allowed in an AstroMonitorSet", objectType))
+			continue
+		}
+		if isNamespaced == nil {
+			continue
+		}
+		if namespaced, err := isNamespaced(gvk); err != nil {
+			errs = append(errs, fmt.Errorf("scope of type %s is unknown: %v", objectType, err))
+		} else if !namespaced {
+			errs = append(errs, fmt.Errorf("type %s is cluster scoped, so it can't be used in an AstroMonitorSet", objectType))
+		}
+	}
+	if len(mSet.Monitors) == 0 && len(mSet.Synthetics) == 0 {
+		errs = append(errs, errors.New("no monitors are defined"))
+	}
+	return errs
+}
+
+// SetMonitorSet adds or replaces the ruleset of the AstroMonitorSet identified by key, in namespace/name format.
+func (config *Config) SetMonitorSet(key string, mSet MonitorSet) {
+	config.rulesetMux.Lock()
+	defer config.rulesetMux.Unlock()
+	if config.customMonitorSets == nil {
+		config.customMonitorSets = make(map[string]MonitorSet)
+	}
+	config.customMonitorSets[key] = mSet
+	config.mergeRulesets()
+}
+
+// DeleteMonitorSet removes the ruleset of the AstroMonitorSet identified by key, in namespace/name format.
+func (config *Config) DeleteMonitorSet(key string) {
+	config.rulesetMux.Lock()
+	defer config.rulesetMux.Unlock()
+	delete(config.customMonitorSets, key)
+	config.mergeRulesets()
+}
+
+// mergeRulesets replaces the Ruleset in use with the rulesets loaded from MonitorDefinitionsPath followed by those from
+// AstroMonitorSets.  rulesetMux must be held.
+func (config *Config) mergeRulesets() {
+	merged := &Ruleset{
+		ClusterVariables: make(map[string]string),
+	}
+	if config.definedRulesets != nil {
+		merged.loaded = true
+		merged.ClusterVariables = config.definedRulesets.ClusterVariables
+		merged.MonitorSets = append(merged.MonitorSets, config.definedRulesets.MonitorSets...)
+	}
+
+	keys := make([]string, 0, len(config.customMonitorSets))
+	for key := range config.customMonitorSets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		mSet, err := copyMonitorSet(config.customMonitorSets[key])
+		if err != nil {
+			log.Errorf("Error copying ruleset of AstroMonitorSet %s: %v", key, err)
+			continue
+		}
+		// the ruleset of an AstroMonitorSet is named after it, so names are unique across namespaces.
+		mSet.Name = key
+		merged.MonitorSets = append(merged.MonitorSets, mSet)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		log.Errorf("Error hashing rulesets: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	merged.hash = hex.EncodeToString(sum[:])
+
+	previous, loaded := config.rulesets.Load().(*Ruleset)
+	config.rulesets.Store(merged)
+	if loaded && (previous.hash != merged.hash || previous.loaded != merged.loaded) {
+		log.Info("Rulesets have changed.")
+		for _, listener := range config.changeListeners {
+			(*listener)()
+		}
+	}
+}
+
+// OnRulesetsChanged registers a function to call whenever the content of the rulesets changes, after they have been
+// replaced.  It is called with rulesetMux held, so it must not block.  The function returned removes the listener.
+func (config *Config) OnRulesetsChanged(listener func()) func() {
+	config.rulesetMux.Lock()
+	defer config.rulesetMux.Unlock()
+	registered := &listener
+	config.changeListeners = append(config.changeListeners, registered)
+	return func() {
+		config.rulesetMux.Lock()
+		defer config.rulesetMux.Unlock()
+		for i, l := range config.changeListeners {
+			if l == registered {
+				config.changeListeners = append(config.changeListeners[:i:i], config.changeListeners[i+1:]...)
+				return
 			}
 		}
 	}
-	return &linkedMonitors
+}
+
+// Rulesets returns the rulesets in use.  The Ruleset returned is never modified, so a reconcile can use it throughout
+// while the rulesets are reloaded.
+func (config *Config) Rulesets() *Ruleset {
+	if rSet, ok := config.rulesets.Load().(*Ruleset); ok {
+		return rSet
+	}
+	return &Ruleset{}
+}
+
+// Loaded returns whether the rulesets from MonitorDefinitionsPath have been loaded successfully.  Until they have, the
+// rulesets in use are incomplete, so monitors must not be deleted for not being defined in them.
+func (config *Config) Loaded() bool {
+	if rSet, ok := config.rulesets.Load().(*Ruleset); ok {
+		return rSet.loaded
+	}
+	return false
+}
+
+// copyMonitorSet returns a deep copy of mSet, so that changes made to matching rulesets don't leak into the stored copy.
+func copyMonitorSet(mSet MonitorSet) (MonitorSet, error) {
+	var out MonitorSet
+	data, err := json.Marshal(mSet)
+	if err != nil {
+		return out, err
+	}
+	err = json.Unmarshal(data, &out)
+	out.Namespace = mSet.Namespace
+	out.defaultName = mSet.defaultName
+	return out, err
+}
+
+// appendIdentityTags tags every monitor and synthetics test in a MonitorSet with the name of the ruleset and its key in
+// the ruleset.  A name defaulted from the position of the ruleset changes when other rulesets are added or removed, so
+// it isn't tagged.
+func (mSet *MonitorSet) appendIdentityTags() {
+	for key, monitor := range mSet.Monitors {
+		if !mSet.defaultName {
+			monitor.Tags = append(monitor.Tags, RulesetTagPrefix+TagValue(mSet.Name))
+		}
+		monitor.Tags = append(monitor.Tags, MonitorTagPrefix+TagValue(key))
+		mSet.Monitors[key] = monitor
+	}
+	for key, test := range mSet.Synthetics {
+		if !mSet.defaultName {
+			test.Tags = append(test.Tags, RulesetTagPrefix+TagValue(mSet.Name))
+		}
+		test.Tags = append(test.Tags, SyntheticsTagPrefix+TagValue(key))
+		mSet.Synthetics[key] = test
+	}
 }
 
 // AppendTag appends a tag to every monitor in a MonitorSet
@@ -213,6 +757,14 @@ func GetInstance() *Config {
 			OwnerTag:               getEnv("OWNER", "astro"),
 			MonitorDefinitionsPath: envAsMap("DEFINITIONS_PATH", []string{"conf.yml"}, ";"),
 			DryRun:                 envAsBool("DRY_RUN", false),
+			NodePoolLabel:          getEnv("NODE_POOL_LABEL", ""),
+			MonitorRefreshInterval: envAsInt("MONITOR_REFRESH_INTERVAL", 10),
+			DatadogSite:            getEnv("DD_SITE", DefaultDatadogSite),
+			DatadogAPIURL:          getEnv("DD_API_URL", ""),
+			DatadogProxyURL:        getEnv("DD_PROXY_URL", ""),
+			DatadogCABundle:        getEnv("DD_CA_BUNDLE", ""),
+			DatadogTimeout:         envAsInt("DD_TIMEOUT", 60),
+			CustomObjectTypes:      envAsMap("ASTROMONITORSET_OBJECT_TYPES", nil, ";"),
 		}
 
 		instance.reloadRulesets()
@@ -231,6 +783,18 @@ func GetInstance() *Config {
 	return instance
 }
 
+// DatadogBaseURL returns the url of the Datadog API, which is DatadogAPIURL if set or the API of DatadogSite.
+func (config *Config) DatadogBaseURL() string {
+	if config.DatadogAPIURL != "" {
+		return strings.TrimSuffix(config.DatadogAPIURL, "/")
+	}
+	site := config.DatadogSite
+	if site == "" {
+		site = DefaultDatadogSite
+	}
+	return "https://api." + strings.TrimSuffix(site, "/")
+}
+
 func contains(slice []string, key string) bool {
 	for _, element := range slice {
 		if element == key {
@@ -240,29 +804,70 @@ func contains(slice []string, key string) bool {
 	return false
 }
 
-func (config *Config) reloadRulesets() {
-	rulesetCollection := &ruleset{
+// Reload loads the rulesets from MonitorDefinitionsPath immediately, rather than waiting for the next periodic reload.
+// If any of them can't be loaded, the rulesets that were last loaded are kept and an error is returned.
+func (config *Config) Reload() error {
+	return config.reloadRulesets()
+}
+
+// reloadRulesets replaces the rulesets from MonitorDefinitionsPath only if every path is loaded successfully, so a
+// transient error loading one of them doesn't remove its monitors.
+func (config *Config) reloadRulesets() error {
+	// reloads are serialized, so an older reload can't replace the rulesets of a newer one.
+	config.reloadMux.Lock()
+	defer config.reloadMux.Unlock()
+
+	rulesetCollection, err := config.loadRulesets()
+	if err != nil {
+		metrics.ConfigReloadErrorCounter.Inc()
+		log.Errorf("Keeping the last loaded rulesets: %v", err)
+		config.rulesetMux.Lock()
+		defer config.rulesetMux.Unlock()
+		if config.rulesets.Load() == nil {
+			// nothing has been loaded yet, so start with only the rulesets from AstroMonitorSets.  Objects aren't
+			// reconciled until a reload succeeds, since monitors of the missing rulesets would be deleted.
+			config.mergeRulesets()
+		}
+		return err
+	}
+
+	config.rulesetMux.Lock()
+	defer config.rulesetMux.Unlock()
+	config.definedRulesets = rulesetCollection
+	config.mergeRulesets()
+	metrics.ConfigReloadTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// loadRulesets loads and validates the rulesets from every path in MonitorDefinitionsPath.  reloadMux must be held.
+func (config *Config) loadRulesets() (*Ruleset, error) {
+	rulesetCollection := &Ruleset{
 		ClusterVariables: make(map[string]string),
 	}
+	namer := NewRulesetNamer()
 
 	for _, cfg := range config.MonitorDefinitionsPath {
 		log.Debugf("Loading rulesets from %s", cfg)
-		rSet := &ruleset{}
+		rSet := &Ruleset{}
 
-		yml, err := loadFromPath(cfg)
+		yml, err := config.loadFromPath(cfg)
 		if err != nil {
-			log.Errorf("Could not load config file %s: %v", cfg, err)
-			return
+			return nil, fmt.Errorf("could not load config file %s: %v", cfg, err)
 		}
 
 		err = yaml.Unmarshal(yml, rSet)
 		if err != nil {
-			log.Errorf("Error unmarshalling config file %s: %v", cfg, err)
-			continue
+			return nil, fmt.Errorf("error unmarshalling config file %s: %v", cfg, err)
 		}
 
-		if rSet.MonitorSets != nil {
-			rulesetCollection.MonitorSets = append(rulesetCollection.MonitorSets, rSet.MonitorSets...)
+		for _, mSet := range rSet.MonitorSets {
+			if err := mSet.validate(); err != nil {
+				return nil, fmt.Errorf("invalid %s ruleset in config file %s: %v", mSet.ObjectType, cfg, err)
+			}
+			if err := namer.Add(&mSet); err != nil {
+				return nil, fmt.Errorf("%s ruleset in config file %s: %v", mSet.ObjectType, cfg, err)
+			}
+			rulesetCollection.MonitorSets = append(rulesetCollection.MonitorSets, mSet)
 		}
 
 		if rSet.ClusterVariables != nil {
@@ -271,17 +876,72 @@ func (config *Config) reloadRulesets() {
 			}
 		}
 	}
-	config.Rulesets = rulesetCollection
+	return rulesetCollection, nil
+}
+
+// A RulesetNamer names rulesets that are loaded together, and checks that the identities of their monitors are unique.
+type RulesetNamer struct {
+	names           map[string]bool
+	positions       map[string]int
+	unnamedMonitors map[string]bool
+}
+
+// NewRulesetNamer returns a RulesetNamer for a new set of rulesets.
+func NewRulesetNamer() *RulesetNamer {
+	return &RulesetNamer{
+		names:           make(map[string]bool),
+		positions:       make(map[string]int),
+		unnamedMonitors: make(map[string]bool),
+	}
+}
+
+// Add defaults the name of an unnamed ruleset from its type and position among the rulesets of that type.  It returns
+// an error if the name is already used, or if an unnamed ruleset has a monitor or synthetics test key that another
+// unnamed ruleset uses for the same object type, since monitors and tests of unnamed rulesets are identified without
+// their ruleset.
+func (namer *RulesetNamer) Add(mSet *MonitorSet) error {
+	if mSet.Name == "" {
+		mSet.Name = fmt.Sprintf("%s-%d", mSet.ObjectType, namer.positions[mSet.ObjectType])
+		mSet.defaultName = true
+		// the monitors of a binding ruleset are applied to the objects of its bound object types.
+		objectTypes := []string{mSet.ObjectType}
+		if mSet.ObjectType == "binding" {
+			objectTypes = mSet.BoundObjects
+		}
+		for key := range mSet.Monitors {
+			for _, objectType := range objectTypes {
+				if namer.unnamedMonitors[objectType+"/"+TagValue(key)] {
+					return fmt.Errorf("monitor %s is also in another unnamed ruleset for %s objects, so the rulesets must be named", key, objectType)
+				}
+			}
+			for _, objectType := range objectTypes {
+				namer.unnamedMonitors[objectType+"/"+TagValue(key)] = true
+			}
+		}
+		for key := range mSet.Synthetics {
+			if namer.unnamedMonitors["synthetics/"+mSet.ObjectType+"/"+TagValue(key)] {
+				return fmt.Errorf("synthetics test %s is also in another unnamed ruleset for %s objects, so the rulesets must be named", key, mSet.ObjectType)
+			}
+			namer.unnamedMonitors["synthetics/"+mSet.ObjectType+"/"+TagValue(key)] = true
+		}
+	}
+	namer.positions[mSet.ObjectType]++
+	if namer.names[TagValue(mSet.Name)] {
+		return fmt.Errorf("the name %s is already used", mSet.Name)
+	}
+	namer.names[TagValue(mSet.Name)] = true
+	return nil
 }
 
-func loadFromPath(path string) ([]byte, error) {
+// loadFromPath reads the content of a path in MonitorDefinitionsPath.  reloadMux must be held.
+func (config *Config) loadFromPath(path string) ([]byte, error) {
+	if source, ok := ParseConfigMapSource(path); ok {
+		return loadFromConfigMap(source)
+	}
+
 	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
 		// path is a url
-		response, err := http.Get(path)
-		if err != nil {
-			return nil, err
-		}
-		return ioutil.ReadAll(response.Body)
+		return config.loadFromURL(path)
 	}
 
 	if _, err := os.Stat(path); err == nil {
@@ -292,6 +952,56 @@ func loadFromPath(path string) ([]byte, error) {
 	return nil, errors.New("not a valid path or URL")
 }
 
+// urlTimeout bounds fetching rulesets from a URL, since reloads wait for each other while it is fetched.
+var urlTimeout = 30 * time.Second
+
+// loadFromURL fetches url with a conditional request, so its content is only downloaded again when it has changed.
+func (config *Config) loadFromURL(url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), urlTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	cached := config.urlSources[url]
+	if cached != nil {
+		if cached.etag != "" {
+			request.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			request.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	client := &http.Client{Timeout: urlTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		log.Debugf("%s has not changed since it was last loaded", url)
+		return cached.data, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %s", response.Status)
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.urlSources == nil {
+		config.urlSources = make(map[string]*urlSource)
+	}
+	config.urlSources[url] = &urlSource{
+		data:         data,
+		etag:         response.Header.Get("ETag"),
+		lastModified: response.Header.Get("Last-Modified"),
+	}
+	return data, nil
+}
+
 func getEnv(key string, defaultVal string) string {
 	log.Debugf("Getting environment variable %s", key)
 	if value, exists := os.LookupEnv(key); exists {
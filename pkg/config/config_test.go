@@ -2,13 +2,24 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	ddapi "github.com/zorkian/go-datadog-api"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/fairwindsops/astro/pkg/metrics"
 )
 
 var annotationCases = map[string]map[string]string{
@@ -25,12 +36,25 @@ var typeCases = map[string]map[string]string{
 		"title": "Deployment Replica Alert - {{ .ObjectMeta.Name }}",
 		"name":  "dep-replica-alert",
 	},
+	"statefulset": {
+		"title": "StatefulSet Replica Alert - {{ .ObjectMeta.Name }}",
+		"name":  "sts-replica-alert",
+	},
 	"namespace": {
 		"title": "Namespaced Deployment Replica Alert - {{ .ObjectMeta.Name }}",
 		"name":  "namespaced-replica-alert",
 	},
 }
 
+func newNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
 func getConf(confPath []string) *Config {
 	config := &Config{
 		MonitorDefinitionsPath: confPath,
@@ -61,8 +85,8 @@ func TestGetInstance(t *testing.T) {
 
 func TestGetClusterVariables(t *testing.T) {
 	cfg := GetInstance()
-	assert.Contains(t, cfg.Rulesets.ClusterVariables, "TEST_FOO")
-	assert.Equal(t, cfg.Rulesets.ClusterVariables["TEST_FOO"], "BAR")
+	assert.Contains(t, cfg.Rulesets().ClusterVariables, "TEST_FOO")
+	assert.Equal(t, cfg.Rulesets().ClusterVariables["TEST_FOO"], "BAR")
 }
 
 func TestGetRulesetsValid(t *testing.T) {
@@ -78,6 +102,16 @@ func TestGetRulesetsValid(t *testing.T) {
 				Value: "5",
 			},
 		},
+		"sts-replica-alert": {
+			{
+				Field: "threshold-critical",
+				Value: "3",
+			},
+			{
+				Field: "threshold-warning",
+				Value: "1",
+			},
+		},
 		"namespaced-replica-alert": {
 			{
 				Field: "threshold-critical",
@@ -94,6 +128,10 @@ func TestGetRulesetsValid(t *testing.T) {
 			"critical": json.Number("10.0"),
 			"warning":  json.Number("5"),
 		},
+		"sts-replica-alert": {
+			"critical": json.Number("3"),
+			"warning":  json.Number("1"),
+		},
 		"namespaced-replica-alert": {
 			"critical": json.Number("500"),
 			"warning":  json.Number("100"),
@@ -103,7 +141,7 @@ func TestGetRulesetsValid(t *testing.T) {
 	for objectType, items := range typeCases {
 		name := items["name"]
 		title := items["title"]
-		mSets := cfg.getMatchingRulesets(annotations, objectType, overrides)
+		mSets := cfg.Rulesets().getMatchingRulesets(annotations, nil, nil, objectType, overrides)
 		assert.Equal(t, 1, len(*mSets))
 		mSet := (*mSets)[0]
 		assert.Equal(t, objectType, mSet.ObjectType)
@@ -112,7 +150,7 @@ func TestGetRulesetsValid(t *testing.T) {
 		assert.Equal(t, thresholds[name]["critical"], *mSet.Monitors[name].Options.Thresholds.Critical)
 		assert.Equal(t, thresholds[name]["warning"], *mSet.Monitors[name].Options.Thresholds.Warning)
 
-		monitors := cfg.GetMatchingMonitors(annotations, objectType, overrides)
+		monitors := cfg.Rulesets().GetMatchingMonitors(annotations, nil, nil, objectType, overrides)
 		var expected []ddapi.Monitor
 		for _, value := range mSet.Monitors {
 			expected = append(expected, value)
@@ -121,15 +159,223 @@ func TestGetRulesetsValid(t *testing.T) {
 	}
 }
 
+func TestGetMatchingMonitorsOverridesAreCopied(t *testing.T) {
+	conf := getConf([]string{"./test_conf.yml"})
+	annotations := annotationCases["pass"]
+	overrides := map[string][]Override{
+		"dep-replica-alert": {
+			{Field: "name", Value: "Overridden"},
+			{Field: "threshold-critical", Value: "5"},
+		},
+	}
+
+	monitors := *conf.Rulesets().GetMatchingMonitors(annotations, nil, nil, "deployment", overrides)
+	assert.Equal(t, "Overridden", *monitors[0].Name)
+	assert.Equal(t, json.Number("5"), *monitors[0].Options.Thresholds.Critical)
+
+	// changes to the monitors returned, like applying templates, don't reach the rulesets either.
+	escalation := "changed"
+	monitors[0].Options.EscalationMessage = &escalation
+
+	monitors = *conf.Rulesets().GetMatchingMonitors(annotations, nil, nil, "deployment", map[string][]Override{})
+	assert.Equal(t, "Deployment Replica Alert - {{ .ObjectMeta.Name }}", *monitors[0].Name)
+	assert.Equal(t, json.Number("0"), *monitors[0].Options.Thresholds.Critical)
+	assert.Equal(t, "", *monitors[0].Options.EscalationMessage)
+}
+
+// TestGetMatchingMonitorsConcurrent matches monitors with different overrides while the rulesets are reloaded, which
+// is what the workqueue handlers and the reload ticker do.  Run it with -race.
+func TestGetMatchingMonitorsConcurrent(t *testing.T) {
+	conf := getConf([]string{"./test_conf.yml"})
+	annotations := annotationCases["pass"]
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				conf.Reload()
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			overrides := map[string][]Override{"dep-replica-alert": {{Field: "name", Value: name}}}
+			for j := 0; j < 20; j++ {
+				rulesets := conf.Rulesets()
+				monitors := *rulesets.GetMatchingMonitors(annotations, nil, nil, "deployment", overrides)
+				if assert.Equal(t, 1, len(monitors)) {
+					assert.Equal(t, name, *monitors[0].Name)
+				}
+				rulesets.GetBoundMonitors(newNamespace("foo", map[string]string{"test": "yup"}), "deployment", overrides)
+			}
+		}(fmt.Sprintf("Override %d", i))
+	}
+	wg.Wait()
+	close(done)
+}
+
 func TestGetRulesetsInvalid(t *testing.T) {
 	for objectType := range typeCases {
 		annotations := annotationCases["fail"]
 		overrides := make(map[string][]Override)
-		mSets := cfg.getMatchingRulesets(annotations, objectType, overrides)
+		mSets := cfg.Rulesets().getMatchingRulesets(annotations, nil, nil, objectType, overrides)
 		assert.Equal(t, 0, len(*mSets))
 	}
 }
 
+func TestGetRulesetsLabels(t *testing.T) {
+	overrides := make(map[string][]Override)
+	mSets := cfg.Rulesets().getMatchingRulesets(nil, map[string]string{"astro/monitored": "true"}, nil, "node", overrides)
+	assert.Equal(t, 1, len(*mSets))
+	assert.Contains(t, (*mSets)[0].Monitors, "node-pool-not-ready")
+
+	mSets = cfg.Rulesets().getMatchingRulesets(nil, map[string]string{"astro/monitored": "false"}, nil, "node", overrides)
+	assert.Equal(t, 0, len(*mSets))
+}
+
+func TestGetRulesetsExpressions(t *testing.T) {
+	rSet := &Ruleset{MonitorSets: []MonitorSet{
+		{
+			ObjectType: "deployment",
+			Expressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"frontend", "api"}},
+				{Key: "canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+			},
+		},
+		{
+			ObjectType: "statefulset",
+			Annotations: []Annotation{
+				{Name: "astro/team", Operator: "NotIn", Values: []string{"data"}},
+				{Name: "astro/owner", Operator: "Exists"},
+			},
+		},
+	}}
+	overrides := make(map[string][]Override)
+
+	labelCases := []struct {
+		labels  map[string]string
+		matches bool
+	}{
+		{map[string]string{"tier": "frontend"}, true},
+		{map[string]string{"tier": "api", "app": "web"}, true},
+		{map[string]string{"tier": "backend"}, false},
+		{map[string]string{"tier": "api", "canary": "true"}, false},
+		{nil, false},
+	}
+	for _, c := range labelCases {
+		mSets := rSet.getMatchingRulesets(nil, c.labels, nil, "deployment", overrides)
+		assert.Equal(t, c.matches, len(*mSets) == 1, c.labels)
+	}
+
+	annotationCases := []struct {
+		annotations map[string]string
+		matches     bool
+	}{
+		{map[string]string{"astro/owner": "me"}, true},
+		{map[string]string{"astro/owner": "me", "astro/team": "web"}, true},
+		{map[string]string{"astro/owner": "me", "astro/team": "data"}, false},
+		{map[string]string{"astro/team": "web"}, false},
+	}
+	for _, c := range annotationCases {
+		mSets := rSet.getMatchingRulesets(c.annotations, nil, nil, "statefulset", overrides)
+		assert.Equal(t, c.matches, len(*mSets) == 1, c.annotations)
+	}
+}
+
+func TestGetRulesetsNamespaces(t *testing.T) {
+	rSet := &Ruleset{MonitorSets: []MonitorSet{
+		{
+			ObjectType:        "deployment",
+			Annotations:       []Annotation{{Name: "astro/owner", Value: "astro"}},
+			ExcludeNamespaces: []string{"kube-system", "preview-*"},
+		},
+		{
+			ObjectType:        "statefulset",
+			Annotations:       []Annotation{{Name: "astro/owner", Value: "astro"}},
+			IncludeNamespaces: []string{"data-*"},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		},
+	}}
+	annotations := map[string]string{"astro/owner": "astro"}
+	overrides := make(map[string][]Override)
+
+	namespaceCases := []struct {
+		objectType string
+		namespace  *corev1.Namespace
+		matches    bool
+	}{
+		{"deployment", newNamespace("web", nil), true},
+		{"deployment", newNamespace("kube-system", nil), false},
+		{"deployment", newNamespace("preview-123", nil), false},
+		{"deployment", nil, true},
+		{"statefulset", newNamespace("data-pg", map[string]string{"env": "prod"}), true},
+		{"statefulset", newNamespace("data-pg", map[string]string{"env": "dev"}), false},
+		{"statefulset", newNamespace("web", map[string]string{"env": "prod"}), false},
+		{"statefulset", nil, false},
+	}
+	for _, c := range namespaceCases {
+		mSets := rSet.getMatchingRulesets(annotations, nil, c.namespace, c.objectType, overrides)
+		assert.Equal(t, c.matches, len(*mSets) == 1, "%s %v", c.objectType, c.namespace)
+	}
+}
+
+func TestGetRulesetsMatchAll(t *testing.T) {
+	rSet := &Ruleset{MonitorSets: []MonitorSet{
+		{ObjectType: "deployment", MatchAll: true},
+		{ObjectType: "statefulset"},
+		{ObjectType: "daemonset", MatchAll: true, Labels: map[string]string{"tier": "web"}},
+	}}
+	overrides := make(map[string][]Override)
+	ignored := map[string]string{IgnoreAnnotation: "true"}
+
+	assert.Equal(t, 1, len(*rSet.getMatchingRulesets(nil, nil, newNamespace("web", nil), "deployment", overrides)))
+	assert.Equal(t, 1, len(*rSet.getMatchingRulesets(map[string]string{IgnoreAnnotation: "false"}, nil, nil, "deployment", overrides)))
+	assert.Equal(t, 0, len(*rSet.getMatchingRulesets(ignored, nil, newNamespace("web", nil), "deployment", overrides)))
+
+	ns := newNamespace("web", nil)
+	ns.Annotations = ignored
+	assert.Equal(t, 0, len(*rSet.getMatchingRulesets(nil, nil, ns, "deployment", overrides)))
+
+	// rulesets without any rules still match nothing
+	assert.Equal(t, 0, len(*rSet.getMatchingRulesets(nil, nil, nil, "statefulset", overrides)))
+
+	// rules still apply to match_all rulesets
+	assert.Equal(t, 1, len(*rSet.getMatchingRulesets(nil, map[string]string{"tier": "web"}, nil, "daemonset", overrides)))
+	assert.Equal(t, 0, len(*rSet.getMatchingRulesets(nil, map[string]string{"tier": "api"}, nil, "daemonset", overrides)))
+}
+
+func TestGetNamespaceDependentObjectTypes(t *testing.T) {
+	rSet := &Ruleset{MonitorSets: []MonitorSet{
+		{ObjectType: "binding", BoundObjects: []string{"deployment"}},
+		{ObjectType: "deployment", MatchAll: true},
+		{ObjectType: "service", NamespaceSelector: &metav1.LabelSelector{}},
+		{ObjectType: "statefulset"},
+		{ObjectType: "node", MatchAll: true},
+		{ObjectType: "argoproj.io/v1alpha1/Rollout", MatchAll: true},
+	}}
+	assert.Equal(t, []string{"deployment", "service", "argoproj.io/v1alpha1/Rollout"}, rSet.GetNamespaceDependentObjectTypes())
+}
+
+func TestValidateMatchRules(t *testing.T) {
+	mSet := MonitorSet{
+		Annotations: []Annotation{{Name: "astro/team", Operator: "In", Values: []string{"web"}}},
+		Expressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpExists}},
+	}
+	assert.NoError(t, mSet.validate())
+
+	assert.Error(t, (&MonitorSet{Annotations: []Annotation{{Name: "astro/team", Operator: "In"}}}).validate())
+	assert.Error(t, (&MonitorSet{Annotations: []Annotation{{Name: "astro/team", Operator: "Matches"}}}).validate())
+	assert.Error(t, (&MonitorSet{Expressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpIn}}}).validate())
+	assert.Error(t, (&MonitorSet{ExcludeNamespaces: []string{"preview-["}}).validate())
+	assert.Error(t, (&MonitorSet{NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Matches"}}}}).validate())
+}
+
 func TestGetBoundMonitorsValid(t *testing.T) {
 	annotations := make(map[string]string, 1)
 	annotations["test"] = "yup"
@@ -142,11 +388,305 @@ func TestGetBoundMonitorsValid(t *testing.T) {
 	}
 
 	overrides := make(map[string][]Override)
-	mSets := cfg.GetBoundMonitors(ns.Annotations, "deployment", overrides)
+	mSets := cfg.Rulesets().GetBoundMonitors(ns, "deployment", overrides)
 	assert.Equal(t, 1, len(*mSets))
 	assert.Contains(t, (*mSets)[0].Tags, "astro:bound_object")
 }
 
+func TestGetBoundMonitorsPersistentVolumeClaim(t *testing.T) {
+	overrides := make(map[string][]Override)
+	ns := newNamespace("volumes", nil)
+	ns.Annotations = map[string]string{"volumes": "monitored"}
+	mSets := cfg.Rulesets().GetBoundMonitors(ns, "persistentvolumeclaim", overrides)
+	assert.Equal(t, 1, len(*mSets))
+	assert.Equal(t, "Bound Volume Usage High - {{ .ObjectMeta.Name }}", *(*mSets)[0].Name)
+
+	mSets = cfg.Rulesets().GetBoundMonitors(ns, "deployment", overrides)
+	assert.Equal(t, 0, len(*mSets))
+}
+
+func TestParseObjectType(t *testing.T) {
+	gvk, ok := ParseObjectType("argoproj.io/v1alpha1/Rollout")
+	assert.True(t, ok)
+	assert.Equal(t, schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, gvk)
+
+	gvk, ok = ParseObjectType("v1/Service")
+	assert.True(t, ok)
+	assert.Equal(t, schema.GroupVersionKind{Version: "v1", Kind: "Service"}, gvk)
+
+	for _, objectType := range []string{"deployment", "static", "a/b/c/d", "argoproj.io//Rollout"} {
+		_, ok = ParseObjectType(objectType)
+		assert.False(t, ok, objectType)
+	}
+}
+
+func TestGetGenericObjectTypes(t *testing.T) {
+	assert.Equal(t, []string{"argoproj.io/v1alpha1/Rollout"}, cfg.Rulesets().GetGenericObjectTypes())
+}
+
+func TestGetBoundObjectTypes(t *testing.T) {
+	assert.Equal(t, []string{"deployment", "statefulset", "persistentvolumeclaim"}, cfg.Rulesets().GetBoundObjectTypes())
+}
+
+func TestValidateBoundObjects(t *testing.T) {
+	mSet := MonitorSet{ObjectType: "binding", BoundObjects: []string{"deployment", "argoproj.io/v1alpha1/Rollout"}}
+	assert.NoError(t, mSet.validate())
+
+	mSet.BoundObjects = append(mSet.BoundObjects, "pods")
+	assert.Error(t, mSet.validate())
+}
+
+func TestReloadRulesetsInvalidBoundObjects(t *testing.T) {
+	file, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`rulesets:
+- type: binding
+  bound_objects:
+    - pods
+  match_annotations:
+    - name: test
+      value: yup
+- type: binding
+  bound_objects:
+    - daemonset
+    - argoproj.io/v1alpha1/Rollout
+  match_annotations:
+    - name: test
+      value: yup
+`)
+	assert.NoError(t, err)
+	file.Close()
+
+	// a ruleset binding a type that isn't watched fails the whole load.
+	conf := getConf([]string{file.Name()})
+	assert.Error(t, conf.Reload())
+	assert.Empty(t, conf.Rulesets().MonitorSets)
+}
+
+func TestMonitorSetNamespace(t *testing.T) {
+	conf := getConf([]string{"./test_conf.yml"})
+	name := "Team Alert - {{ .ObjectMeta.Name }}"
+	conf.SetMonitorSet("team/alerts", MonitorSet{
+		ObjectType:  "deployment",
+		Namespace:   "team",
+		Annotations: []Annotation{{Name: "astro/owner", Value: "astro"}},
+		Monitors:    map[string]ddapi.Monitor{"team-alert": {Name: &name}},
+	})
+	annotations := annotationCases["pass"]
+	overrides := make(map[string][]Override)
+
+	assert.Equal(t, 2, len(*conf.Rulesets().GetMatchingMonitors(annotations, nil, newNamespace("team", nil), "deployment", overrides)))
+	assert.Equal(t, 1, len(*conf.Rulesets().GetMatchingMonitors(annotations, nil, newNamespace("other", nil), "deployment", overrides)))
+
+	// rulesets from AstroMonitorSets survive reloading the definitions
+	conf.reloadRulesets()
+	assert.Equal(t, 2, len(*conf.Rulesets().GetMatchingMonitors(annotations, nil, newNamespace("team", nil), "deployment", overrides)))
+
+	conf.DeleteMonitorSet("team/alerts")
+	assert.Equal(t, 1, len(*conf.Rulesets().GetMatchingMonitors(annotations, nil, newNamespace("team", nil), "deployment", overrides)))
+}
+
+func TestRulesetNames(t *testing.T) {
+	file, err := ioutil.TempFile("", "names_conf*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`---
+rulesets:
+- type: deployment
+  match_all: true
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} replicas"
+- name: Team Deployments
+  type: deployment
+  match_all: true
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} team replicas"
+- type: deployment
+  match_all: true
+  monitors:
+    pods:
+      name: "{{ .ObjectMeta.Name }} pods"
+`)
+	assert.NoError(t, err)
+	file.Close()
+
+	conf := getConf([]string{file.Name()})
+	var names []string
+	for _, mSet := range conf.Rulesets().MonitorSets {
+		names = append(names, mSet.Name)
+	}
+	assert.Equal(t, []string{"deployment-0", "Team Deployments", "deployment-2"}, names)
+
+	tags := map[string][]string{}
+	for _, monitor := range *conf.Rulesets().GetMatchingMonitors(nil, nil, newNamespace("default", nil), "deployment", map[string][]Override{}) {
+		tags[*monitor.Name] = monitor.Tags
+	}
+	// names defaulted from the position of a ruleset aren't part of the identity of its monitors, so removing an
+	// earlier ruleset doesn't change them.
+	assert.Equal(t, []string{"astro:monitor:replicas"}, tags["{{ .ObjectMeta.Name }} replicas"])
+	assert.Equal(t, []string{"astro:ruleset:team_deployments", "astro:monitor:replicas"}, tags["{{ .ObjectMeta.Name }} team replicas"])
+	assert.Equal(t, []string{"astro:monitor:pods"}, tags["{{ .ObjectMeta.Name }} pods"])
+
+	// rulesets from AstroMonitorSets are named after the AstroMonitorSet.
+	name := "Team Alert"
+	conf.SetMonitorSet("team/alerts", MonitorSet{
+		ObjectType: "statefulset",
+		Namespace:  "team",
+		MatchAll:   true,
+		Monitors:   map[string]ddapi.Monitor{"team-alert": {Name: &name}},
+	})
+	monitors := *conf.Rulesets().GetMatchingMonitors(nil, nil, newNamespace("team", nil), "statefulset", map[string][]Override{})
+	assert.Equal(t, 1, len(monitors))
+	assert.Equal(t, []string{"astro:ruleset:team/alerts", "astro:monitor:team-alert"}, monitors[0].Tags)
+}
+
+func TestRulesetNamesRequired(t *testing.T) {
+	file, err := ioutil.TempFile("", "names_conf*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`---
+rulesets:
+- type: deployment
+  match_all: true
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} replicas"
+- type: deployment
+  match_annotations:
+    - name: team
+      value: web
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} web replicas"
+`)
+	assert.NoError(t, err)
+	file.Close()
+
+	// the monitors would have the same identity, so unnamed rulesets of a type can't share a monitor key.
+	conf := &Config{MonitorDefinitionsPath: []string{file.Name()}}
+	assert.EqualError(t, conf.Reload(), "deployment ruleset in config file "+file.Name()+": monitor replicas is also in another unnamed ruleset for deployment objects, so the rulesets must be named")
+}
+
+func TestRulesetNamesRequiredForBoundObjects(t *testing.T) {
+	file, err := ioutil.TempFile("", "names_conf*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`---
+rulesets:
+- type: deployment
+  match_all: true
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} replicas"
+- type: binding
+  match_annotations:
+    - name: astro/admin-bound
+      value: "true"
+  bound_objects:
+    - statefulset
+    - deployment
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} bound replicas"
+`)
+	assert.NoError(t, err)
+	file.Close()
+
+	// the monitors of a binding ruleset end up on its bound objects, so they would have the same identity as the
+	// monitors of the deployment ruleset.
+	conf := &Config{MonitorDefinitionsPath: []string{file.Name()}}
+	assert.EqualError(t, conf.Reload(), "binding ruleset in config file "+file.Name()+": monitor replicas is also in another unnamed ruleset for deployment objects, so the rulesets must be named")
+}
+
+func TestSyntheticsOnlyInIngressRulesets(t *testing.T) {
+	name := "Up"
+	mSet := MonitorSet{
+		ObjectType:   "binding",
+		BoundObjects: []string{"deployment"},
+		Synthetics:   map[string]ddapi.SyntheticsTest{"up": {Name: &name}},
+	}
+	assert.EqualError(t, mSet.validate(), "synthetics tests can only be defined in ingress rulesets")
+
+	mSet.ObjectType = "ingress"
+	mSet.BoundObjects = nil
+	assert.NoError(t, mSet.validate())
+}
+
+func TestTagValue(t *testing.T) {
+	assert.Equal(t, "team_deployments", TagValue("Team Deployments"))
+	assert.Equal(t, "argoproj.io/v1alpha1/rollout-0", TagValue("argoproj.io/v1alpha1/Rollout-0"))
+	assert.Equal(t, "a_b_c:d", TagValue("a{b}c:d"))
+}
+
+func TestDatadogBaseURL(t *testing.T) {
+	assert.Equal(t, "https://api.datadoghq.com", (&Config{}).DatadogBaseURL())
+	assert.Equal(t, "https://api.datadoghq.eu", (&Config{DatadogSite: "datadoghq.eu"}).DatadogBaseURL())
+	assert.Equal(t, "https://api.us5.datadoghq.com", (&Config{DatadogSite: "us5.datadoghq.com/"}).DatadogBaseURL())
+	assert.Equal(t, "http://127.0.0.1:8080", (&Config{DatadogSite: "datadoghq.eu", DatadogAPIURL: "http://127.0.0.1:8080/"}).DatadogBaseURL())
+}
+
+func TestValidateCustom(t *testing.T) {
+	name := "Team Alert"
+	mSet := MonitorSet{
+		ObjectType: "deployment",
+		Monitors:   map[string]ddapi.Monitor{"team-alert": {Name: &name}},
+	}
+	assert.Empty(t, mSet.ValidateCustom(nil, nil))
+
+	mSet.ObjectType = "static"
+	mSet.BoundObjects = []string{"pods"}
+	assert.Equal(t, 2, len(mSet.ValidateCustom(nil, nil)))
+
+	assert.Equal(t, 2, len((&MonitorSet{}).ValidateCustom(nil, nil)))
+}
+
+func TestValidateCustomObjectTypes(t *testing.T) {
+	name := "Team Alert"
+	allowed := []string{"argoproj.io/v1alpha1/Rollout", "v1/PersistentVolume"}
+	isNamespaced := func(gvk schema.GroupVersionKind) (bool, error) {
+		switch gvk.Kind {
+		case "Rollout":
+			return true, nil
+		case "PersistentVolume":
+			return false, nil
+		}
+		return false, fmt.Errorf("no matches for kind %s", gvk.Kind)
+	}
+	mSet := MonitorSet{
+		ObjectType: "argoproj.io/v1alpha1/Rollout",
+		Monitors:   map[string]ddapi.Monitor{"team-alert": {Name: &name}},
+	}
+	assert.Empty(t, mSet.ValidateCustom(allowed, isNamespaced))
+	assert.Equal(t, []error{errors.New("type argoproj.io/v1alpha1/Rollout is not allowed in an AstroMonitorSet")}, mSet.ValidateCustom(nil, isNamespaced))
+
+	mSet.ObjectType = "v1/PersistentVolume"
+	assert.Equal(t, []error{errors.New("type v1/PersistentVolume is cluster scoped, so it can't be used in an AstroMonitorSet")}, mSet.ValidateCustom(allowed, isNamespaced))
+	// the scope isn't checked without isNamespaced.
+	assert.Empty(t, mSet.ValidateCustom(allowed, nil))
+
+	mSet.ObjectType = "binding"
+	mSet.BoundObjects = []string{"deployment", "v1/PersistentVolume", "example.com/v1/Widget"}
+	assert.Equal(t, []error{
+		errors.New("type v1/PersistentVolume is cluster scoped, so it can't be used in an AstroMonitorSet"),
+		errors.New("type example.com/v1/Widget is not allowed in an AstroMonitorSet"),
+	}, mSet.ValidateCustom(allowed, isNamespaced))
+}
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, (&MonitorSet{ObjectType: "deployment"}).Validate())
+	assert.Empty(t, (&MonitorSet{ObjectType: "argoproj.io/v1alpha1/Rollout"}).Validate())
+	assert.Empty(t, (&MonitorSet{ObjectType: "binding", BoundObjects: []string{"deployment"}}).Validate())
+
+	errs := (&MonitorSet{ObjectType: "deploymnt"}).Validate()
+	assert.Equal(t, 1, len(errs))
+	assert.EqualError(t, errs[0], "type deploymnt is not a known object type")
+
+	assert.Equal(t, 1, len((&MonitorSet{}).Validate()))
+}
+
 func TestGenEnvAsInt(t *testing.T) {
 	os.Setenv("testing", "1")
 	presentEnv := envAsInt("testing", 0)
@@ -167,11 +707,198 @@ func TestLoadFromPathInvalid(t *testing.T) {
 	var invalidHTTP = "https://fake.fake/config.yml"
 	var invalidLocal = "./fake.yml"
 
-	data, err := loadFromPath(invalidHTTP)
+	data, err := (&Config{}).loadFromPath(invalidHTTP)
 	assert.Error(t, err)
 	assert.Empty(t, data)
 
-	data, err = loadFromPath(invalidLocal)
+	data, err = (&Config{}).loadFromPath(invalidLocal)
+	assert.Error(t, err)
+	assert.Empty(t, data)
+}
+
+func TestLoadFromPathErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	data, err := (&Config{}).loadFromPath(server.URL + "/conf.yml")
 	assert.Error(t, err)
 	assert.Empty(t, data)
 }
+
+func TestReloadRulesetsKeepsLastLoaded(t *testing.T) {
+	file, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("rulesets:\n- type: deployment\n  match_annotations:\n    - name: astro/owner\n      value: astro\n")
+	assert.NoError(t, err)
+	file.Close()
+
+	conf := getConf([]string{"./test_conf.yml"})
+	loaded := len(conf.Rulesets().MonitorSets)
+	failures := testutil.ToFloat64(metrics.ConfigReloadErrorCounter)
+
+	// a path that can't be loaded keeps every ruleset, not just those after it.
+	conf.MonitorDefinitionsPath = []string{"./fake.yml", file.Name()}
+	assert.Error(t, conf.Reload())
+	assert.Equal(t, loaded, len(conf.Rulesets().MonitorSets))
+
+	// as does a file that can't be unmarshalled.
+	invalid, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(invalid.Name())
+	_, err = invalid.WriteString("rulesets: {")
+	assert.NoError(t, err)
+	invalid.Close()
+	conf.MonitorDefinitionsPath = []string{file.Name(), invalid.Name()}
+	assert.Error(t, conf.Reload())
+	assert.Equal(t, loaded, len(conf.Rulesets().MonitorSets))
+	assert.Equal(t, failures+2, testutil.ToFloat64(metrics.ConfigReloadErrorCounter))
+
+	conf.MonitorDefinitionsPath = []string{file.Name()}
+	assert.NoError(t, conf.Reload())
+	assert.Equal(t, 1, len(conf.Rulesets().MonitorSets))
+	assert.InDelta(t, float64(time.Now().Unix()), testutil.ToFloat64(metrics.ConfigReloadTimestamp), 5)
+}
+
+func TestReloadRulesetsInvalidRuleset(t *testing.T) {
+	valid, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(valid.Name())
+	_, err = valid.WriteString("rulesets:\n- name: team deployments\n  type: deployment\n  match_all: true\n")
+	assert.NoError(t, err)
+	valid.Close()
+	invalid, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(invalid.Name())
+	_, err = invalid.WriteString("rulesets:\n- type: deployment\n  match_labels:\n    \"not a label\": foo\n")
+	assert.NoError(t, err)
+	invalid.Close()
+	duplicate, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(duplicate.Name())
+	// the name is the same as the valid file's once it's a tag.
+	_, err = duplicate.WriteString("rulesets:\n- name: Team Deployments\n  type: statefulset\n  match_all: true\n")
+	assert.NoError(t, err)
+	duplicate.Close()
+
+	conf := getConf([]string{"./test_conf.yml"})
+	loaded := conf.Rulesets()
+	failures := testutil.ToFloat64(metrics.ConfigReloadErrorCounter)
+
+	conf.MonitorDefinitionsPath = []string{valid.Name(), invalid.Name()}
+	assert.Error(t, conf.Reload())
+	assert.Same(t, loaded, conf.Rulesets())
+
+	conf.MonitorDefinitionsPath = []string{valid.Name(), duplicate.Name()}
+	assert.Error(t, conf.Reload())
+	assert.Same(t, loaded, conf.Rulesets())
+	assert.Equal(t, failures+2, testutil.ToFloat64(metrics.ConfigReloadErrorCounter))
+}
+
+func TestReloadRulesetsInitialFailure(t *testing.T) {
+	conf := getConf([]string{"./fake.yml"})
+	assert.NotNil(t, conf.Rulesets())
+	assert.Empty(t, conf.Rulesets().MonitorSets)
+	// monitors aren't reconciled against the incomplete rulesets.
+	assert.False(t, conf.Loaded())
+
+	changes := 0
+	conf.OnRulesetsChanged(func() { changes++ })
+	conf.MonitorDefinitionsPath = []string{"./test_conf.yml"}
+	assert.NoError(t, conf.Reload())
+	assert.True(t, conf.Loaded())
+	assert.Equal(t, 1, changes)
+}
+
+func TestReloadRulesetsConditionalRequests(t *testing.T) {
+	var requests, downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/etag.yml":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/modified.yml":
+			if r.Header.Get("If-Modified-Since") == "Wed, 21 Oct 2020 07:28:00 GMT" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2020 07:28:00 GMT")
+		}
+		downloads++
+		w.Write([]byte("rulesets:\n- type: deployment\n  match_annotations:\n    - name: astro/owner\n      value: astro\n"))
+	}))
+	defer server.Close()
+
+	conf := getConf([]string{server.URL + "/etag.yml", server.URL + "/modified.yml"})
+	assert.Equal(t, 2, len(conf.Rulesets().MonitorSets))
+	assert.Equal(t, 2, downloads)
+
+	// unchanged sources are requested again, but not downloaded, and their rulesets are kept.
+	assert.NoError(t, conf.Reload())
+	assert.Equal(t, 2, len(conf.Rulesets().MonitorSets))
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, 2, downloads)
+
+	// matching monitors doesn't fetch the sources.
+	conf.Rulesets().GetMatchingMonitors(annotationCases["pass"], nil, nil, "deployment", map[string][]Override{})
+	assert.Equal(t, 4, requests)
+}
+
+func TestLoadFromURLTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("rulesets:\n"))
+		w.(http.Flusher).Flush()
+		// the body stalls until the test ends.
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	defer func(timeout time.Duration) { urlTimeout = timeout }(urlTimeout)
+	urlTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := (&Config{}).loadFromURL(server.URL + "/conf.yml")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestOnRulesetsChanged(t *testing.T) {
+	file, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	rules := "rulesets:\n- type: deployment\n  match_annotations:\n    - name: astro/owner\n      value: %s\n"
+	assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(fmt.Sprintf(rules, "astro")), 0644))
+
+	conf := getConf([]string{file.Name()})
+	var changes int
+	conf.OnRulesetsChanged(func() { changes++ })
+
+	// reloading rulesets that haven't changed doesn't reconcile anything.
+	assert.NoError(t, conf.Reload())
+	assert.Equal(t, 0, changes)
+
+	assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(fmt.Sprintf(rules, "team")), 0644))
+	assert.NoError(t, conf.Reload())
+	assert.Equal(t, 1, changes)
+
+	conf.SetMonitorSet("team/alerts", MonitorSet{ObjectType: "deployment", Namespace: "team"})
+	assert.Equal(t, 2, changes)
+	conf.DeleteMonitorSet("team/alerts")
+	assert.Equal(t, 3, changes)
+
+	// removed listeners aren't called.
+	var removed int
+	remove := conf.OnRulesetsChanged(func() { removed++ })
+	remove()
+	conf.SetMonitorSet("team/alerts", MonitorSet{ObjectType: "deployment", Namespace: "team"})
+	assert.Equal(t, 4, changes)
+	assert.Equal(t, 0, removed)
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+const configMapScheme = "configmap://"
+
+// A ConfigMapSource is a key of a ConfigMap that rulesets are loaded from.  It is written in
+// MonitorDefinitionsPath as configmap://namespace/name/key.
+type ConfigMapSource struct {
+	Namespace string // The namespace of the ConfigMap.
+	Name      string // The name of the ConfigMap.
+	Key       string // The key in the ConfigMap's data that holds the rulesets.
+}
+
+func (source ConfigMapSource) String() string {
+	return fmt.Sprintf("%s%s/%s/%s", configMapScheme, source.Namespace, source.Name, source.Key)
+}
+
+// ParseConfigMapSource returns the ConfigMapSource of a path written as configmap://namespace/name/key.
+// ok is false for any other path.
+func ParseConfigMapSource(path string) (source ConfigMapSource, ok bool) {
+	if !strings.HasPrefix(path, configMapScheme) {
+		return source, false
+	}
+	parts := strings.Split(strings.TrimPrefix(path, configMapScheme), "/")
+	if len(parts) != 3 {
+		return source, false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return source, false
+		}
+	}
+	return ConfigMapSource{Namespace: parts[0], Name: parts[1], Key: parts[2]}, true
+}
+
+// GetConfigMapSources returns the ConfigMaps in MonitorDefinitionsPath.
+func (config *Config) GetConfigMapSources() []ConfigMapSource {
+	var sources []ConfigMapSource
+	for _, path := range config.MonitorDefinitionsPath {
+		if source, ok := ParseConfigMapSource(path); ok {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+var configMapStores = make(map[string]cache.Store)
+var configMapStoreMux sync.RWMutex
+
+// RegisterConfigMapStore sets the informer cache that a ConfigMap is read from when loading rulesets.
+// ConfigMaps without a cache are read from the Kubernetes API.
+func RegisterConfigMapStore(namespace string, name string, store cache.Store) {
+	configMapStoreMux.Lock()
+	defer configMapStoreMux.Unlock()
+	configMapStores[fmt.Sprintf("%s/%s", namespace, name)] = store
+}
+
+func loadFromConfigMap(source ConfigMapSource) ([]byte, error) {
+	configMap, err := getConfigMap(source.Namespace, source.Name)
+	if err != nil {
+		return nil, err
+	}
+	if data, found := configMap.Data[source.Key]; found {
+		return []byte(data), nil
+	}
+	return nil, fmt.Errorf("key %s not found in configmap %s/%s", source.Key, source.Namespace, source.Name)
+}
+
+func getConfigMap(namespace string, name string) (*corev1.ConfigMap, error) {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	configMapStoreMux.RLock()
+	store, found := configMapStores[key]
+	configMapStoreMux.RUnlock()
+	if found {
+		obj, exists, err := store.GetByKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return obj.(*corev1.ConfigMap), nil
+		}
+	}
+	// the cache may not have synced yet, so fall back to the API.
+	return kube.GetInstance().Client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
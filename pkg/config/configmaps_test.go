@@ -0,0 +1,69 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+const configMapRulesets = `rulesets:
+- type: deployment
+  match_annotations:
+    - name: astro/owner
+      value: astro
+  monitors:
+    cm-alert:
+      name: "ConfigMap Alert - {{ .ObjectMeta.Name }}"
+`
+
+func TestParseConfigMapSource(t *testing.T) {
+	source, ok := ParseConfigMapSource("configmap://astro/rules/conf.yml")
+	assert.True(t, ok)
+	assert.Equal(t, ConfigMapSource{Namespace: "astro", Name: "rules", Key: "conf.yml"}, source)
+	assert.Equal(t, "configmap://astro/rules/conf.yml", source.String())
+
+	for _, path := range []string{"conf.yml", "https://example.com/conf.yml", "configmap://astro/rules", "configmap://astro//conf.yml"} {
+		_, ok = ParseConfigMapSource(path)
+		assert.False(t, ok, path)
+	}
+
+	conf := &Config{MonitorDefinitionsPath: []string{"conf.yml", "configmap://astro/rules/conf.yml"}}
+	assert.Equal(t, []ConfigMapSource{source}, conf.GetConfigMapSources())
+}
+
+func TestLoadFromConfigMap(t *testing.T) {
+	kubeClient := kube.SetAndGetMock()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rules",
+			Namespace: "astro",
+		},
+		Data: map[string]string{"conf.yml": configMapRulesets},
+	}
+	kubeClient.Client.CoreV1().ConfigMaps("astro").Create(context.TODO(), configMap, metav1.CreateOptions{})
+
+	conf := getConf([]string{"configmap://astro/rules/conf.yml"})
+	assert.Equal(t, 1, len(conf.Rulesets().MonitorSets))
+	assert.Contains(t, conf.Rulesets().MonitorSets[0].Monitors, "cm-alert")
+
+	_, err := (&Config{}).loadFromPath("configmap://astro/rules/missing.yml")
+	assert.Error(t, err)
+	_, err = (&Config{}).loadFromPath("configmap://astro/missing/conf.yml")
+	assert.Error(t, err)
+
+	// ConfigMaps are read from their informer cache once it is registered
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	cached := configMap.DeepCopy()
+	cached.Data["conf.yml"] = "rulesets: []"
+	store.Add(cached)
+	RegisterConfigMapStore("astro", "rules", store)
+
+	conf.Reload()
+	assert.Equal(t, 0, len(conf.Rulesets().MonitorSets))
+}
@@ -24,8 +24,15 @@ import (
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
 	v1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	rt "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -44,10 +51,21 @@ type KubeResourceWatcher struct {
 	kubeClient kubernetes.Interface
 	informer   cache.SharedIndexInformer
 	wq         workqueue.RateLimitingInterface
+	resource   string        // The type of object watched
+	resync     chan struct{} // Signals that every object should be reconciled again
 }
 
-// Watch tells the KubeResourceWatcher to start waiting for events
-func (watcher *KubeResourceWatcher) Watch(term <-chan struct{}) {
+// resyncLimiter limits how quickly objects are queued when the rulesets change, across every watcher, so a change to
+// the rulesets doesn't send a burst of requests to the Datadog API.
+var resyncLimiter = rate.NewLimiter(rate.Limit(getResyncRate()), 1)
+
+// resyncInterval is how often every object is reconciled again, so monitors changed or deleted in Datadog are
+// reverted or recreated.  A zero interval disables the periodic resync.
+var resyncInterval = getResyncInterval()
+
+// Watch tells the KubeResourceWatcher to start waiting for events.  Events are handled with ctx, so the requests they
+// make are cancelled when it is done.
+func (watcher *KubeResourceWatcher) Watch(ctx context.Context, term <-chan struct{}) {
 	log.Debugf("Starting watcher.")
 
 	defer watcher.wq.ShutDown()
@@ -61,12 +79,86 @@ func (watcher *KubeResourceWatcher) Watch(term <-chan struct{}) {
 	}
 
 	log.Debugf("Watcher synced.")
-	wait.Until(watcher.waitForEvents, time.Second, term)
+	if watcher.resource != "astromonitorset" {
+		// AstroMonitorSets are where rulesets come from, so they aren't reconciled when the rulesets change.
+		removeListener := config.GetInstance().OnRulesetsChanged(watcher.Resync)
+		defer removeListener()
+		go watcher.resyncLoop(term, resyncInterval)
+	}
+	wait.Until(func() { watcher.waitForEvents(ctx) }, time.Second, term)
+}
+
+// Resync reconciles every object the watcher has seen again.  If a resync is already in progress, another starts once
+// it has finished.
+func (watcher *KubeResourceWatcher) Resync() {
+	select {
+	case watcher.resync <- struct{}{}:
+	default:
+		// a resync is already pending.
+	}
 }
 
-func (watcher *KubeResourceWatcher) waitForEvents() {
+// resyncLoop reconciles every object again when Resync is called, and every interval if the interval is not zero.
+func (watcher *KubeResourceWatcher) resyncLoop(term <-chan struct{}, interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-term:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var periodic <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		periodic = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-watcher.resync:
+			log.Infof("Reconciling %d objects of type %s with the changed rulesets.", len(watcher.informer.GetIndexer().ListKeys()), watcher.resource)
+			if !watcher.resyncAll(ctx) {
+				return
+			}
+		case <-periodic:
+			log.Infof("Reconciling %d objects of type %s to correct drift in Datadog.", len(watcher.informer.GetIndexer().ListKeys()), watcher.resource)
+			if !watcher.resyncAll(ctx) {
+				return
+			}
+		}
+	}
+}
+
+// resyncAll queues a resync event for every object the watcher has seen.  It returns false if the context is done.
+func (watcher *KubeResourceWatcher) resyncAll(ctx context.Context) bool {
+	for _, key := range watcher.informer.GetIndexer().ListKeys() {
+		if err := resyncLimiter.Wait(ctx); err != nil {
+			return false
+		}
+		obj, exists, err := watcher.informer.GetIndexer().GetByKey(key)
+		if err != nil || !exists {
+			continue
+		}
+		// resync events have no metadata, so an object that is already queued to be resynced is only queued once.
+		watcher.wq.Add(config.Event{
+			EventType:    "resync",
+			Key:          key,
+			Namespace:    objectMeta(obj).Namespace,
+			ResourceType: watcher.resource,
+		})
+	}
+	return true
+}
+
+func (watcher *KubeResourceWatcher) waitForEvents(ctx context.Context) {
 	// just keep running forever
-	for watcher.next() {
+	for watcher.next(ctx) {
 
 	}
 }
@@ -81,19 +173,23 @@ func (watcher *KubeResourceWatcher) LastSyncResourceVersion() string {
 	return watcher.informer.LastSyncResourceVersion()
 }
 
-func (watcher *KubeResourceWatcher) process(evt config.Event) error {
-	info, _, err := watcher.informer.GetIndexer().GetByKey(evt.Key)
+func (watcher *KubeResourceWatcher) process(ctx context.Context, evt config.Event) error {
+	info, exists, err := watcher.informer.GetIndexer().GetByKey(evt.Key)
 
 	if err != nil {
 		//TODO - need some better error handling here
 		return err
 	}
+	if !exists && evt.EventType == "resync" {
+		// the object was deleted after it was queued.
+		return nil
+	}
 
-	handler.OnUpdate(info, evt)
+	handler.OnUpdate(ctx, info, evt)
 	return nil
 }
 
-func (watcher *KubeResourceWatcher) next() bool {
+func (watcher *KubeResourceWatcher) next(ctx context.Context) bool {
 	evt, err := watcher.wq.Get()
 
 	if err {
@@ -101,7 +197,7 @@ func (watcher *KubeResourceWatcher) next() bool {
 	}
 
 	defer watcher.wq.Done(evt)
-	processErr := watcher.process(evt.(config.Event))
+	processErr := watcher.process(ctx, evt.(config.Event))
 	if processErr != nil {
 		// limit the number of retries
 		if watcher.wq.NumRequeues(evt) < 5 {
@@ -130,12 +226,18 @@ func New(ctx context.Context) {
 		NewMeta:      nil,
 		ResourceType: "static",
 	}
-	handler.StaticMonitorUpdate(staticEvent)
+	handler.StaticMonitorUpdate(ctx, staticEvent)
 	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 	go func() {
-		for range ticker.C {
-			log.Debug("Checking for static monitor updates.")
-			handler.StaticMonitorUpdate(staticEvent)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				log.Debug("Checking for static monitor updates.")
+				handler.StaticMonitorUpdate(ctx, staticEvent)
+			}
 		}
 	}()
 
@@ -154,11 +256,86 @@ func New(ctx context.Context) {
 		0,
 		cache.Indexers{},
 	)
-	rateLimit := getRateLimitTime()
-	DeployWatcher := createController(kubeClient.Client, DeploymentInformer, "deployment", rateLimit)
+	DeployWatcher := createController(kubeClient.Client, DeploymentInformer, "deployment")
 	dTerm := make(chan struct{})
 	defer close(dTerm)
-	go DeployWatcher.Watch(dTerm)
+	go DeployWatcher.Watch(ctx, dTerm)
+
+	log.Debug("Creating watcher for StatefulSets.")
+	StatefulSetInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.AppsV1().StatefulSets("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.AppsV1().StatefulSets("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&v1.StatefulSet{},
+		0,
+		cache.Indexers{},
+	)
+	StatefulSetWatcher := createController(kubeClient.Client, StatefulSetInformer, "statefulset")
+	stsTerm := make(chan struct{})
+	defer close(stsTerm)
+	go StatefulSetWatcher.Watch(ctx, stsTerm)
+
+	log.Debug("Creating watcher for DaemonSets.")
+	DaemonSetInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.AppsV1().DaemonSets("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.AppsV1().DaemonSets("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&v1.DaemonSet{},
+		0,
+		cache.Indexers{},
+	)
+	DaemonSetWatcher := createController(kubeClient.Client, DaemonSetInformer, "daemonset")
+	dsTerm := make(chan struct{})
+	defer close(dsTerm)
+	go DaemonSetWatcher.Watch(ctx, dsTerm)
+
+	log.Debug("Creating watcher for CronJobs.")
+	CronJobInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.BatchV1beta1().CronJobs("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.BatchV1beta1().CronJobs("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&batchv1beta1.CronJob{},
+		0,
+		cache.Indexers{},
+	)
+	CronJobWatcher := createController(kubeClient.Client, CronJobInformer, "cronjob")
+	cjTerm := make(chan struct{})
+	defer close(cjTerm)
+	go CronJobWatcher.Watch(ctx, cjTerm)
+
+	log.Debug("Creating watcher for Jobs.")
+	JobInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.BatchV1().Jobs("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.BatchV1().Jobs("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&batchv1.Job{},
+		0,
+		cache.Indexers{},
+	)
+	JobWatcher := createController(kubeClient.Client, JobInformer, "job")
+	jobTerm := make(chan struct{})
+	defer close(jobTerm)
+	go JobWatcher.Watch(ctx, jobTerm)
 
 	log.Debug("Creating watcher for Namespaces.")
 	NSInformer := cache.NewSharedIndexInformer(
@@ -174,10 +351,119 @@ func New(ctx context.Context) {
 		0,
 		cache.Indexers{},
 	)
-	NSWatcher := createController(kubeClient.Client, NSInformer, "namespace", rateLimit)
+	NSWatcher := createController(kubeClient.Client, NSInformer, "namespace")
 	nsTerm := make(chan struct{})
 	defer close(nsTerm)
-	go NSWatcher.Watch(nsTerm)
+	go NSWatcher.Watch(ctx, nsTerm)
+
+	log.Debug("Creating watcher for Ingresses.")
+	IngressInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.NetworkingV1().Ingresses("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&networkingv1.Ingress{},
+		0,
+		cache.Indexers{},
+	)
+	IngressWatcher := createController(kubeClient.Client, IngressInformer, "ingress")
+	ingTerm := make(chan struct{})
+	defer close(ingTerm)
+	go IngressWatcher.Watch(ctx, ingTerm)
+
+	log.Debug("Creating watcher for Services.")
+	ServiceInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.CoreV1().Services("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&corev1.Service{},
+		0,
+		cache.Indexers{},
+	)
+	ServiceWatcher := createController(kubeClient.Client, ServiceInformer, "service")
+	svcTerm := make(chan struct{})
+	defer close(svcTerm)
+	go ServiceWatcher.Watch(ctx, svcTerm)
+
+	log.Debug("Creating watcher for HorizontalPodAutoscalers.")
+	HPAInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.AutoscalingV1().HorizontalPodAutoscalers("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.AutoscalingV1().HorizontalPodAutoscalers("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&autoscalingv1.HorizontalPodAutoscaler{},
+		0,
+		cache.Indexers{},
+	)
+	HPAWatcher := createController(kubeClient.Client, HPAInformer, "horizontalpodautoscaler")
+	hpaTerm := make(chan struct{})
+	defer close(hpaTerm)
+	go HPAWatcher.Watch(ctx, hpaTerm)
+
+	log.Debug("Creating watcher for PersistentVolumeClaims.")
+	PVCInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.CoreV1().PersistentVolumeClaims("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.CoreV1().PersistentVolumeClaims("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&corev1.PersistentVolumeClaim{},
+		0,
+		cache.Indexers{},
+	)
+	PVCWatcher := createController(kubeClient.Client, PVCInformer, "persistentvolumeclaim")
+	pvcTerm := make(chan struct{})
+	defer close(pvcTerm)
+	go PVCWatcher.Watch(ctx, pvcTerm)
+
+	log.Debug("Creating watcher for Nodes.")
+	NodeInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.CoreV1().Nodes().Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&corev1.Node{},
+		0,
+		cache.Indexers{},
+	)
+	NodeWatcher := createController(kubeClient.Client, NodeInformer, "node")
+	nodeTerm := make(chan struct{})
+	defer close(nodeTerm)
+	go NodeWatcher.Watch(ctx, nodeTerm)
+
+	genericTerm := make(chan struct{})
+	defer close(genericTerm)
+	go watchGenericResources(ctx, kubeClient, genericTerm)
+
+	log.Debug("Creating watchers for ConfigMap rulesets.")
+	cmTerm := make(chan struct{})
+	defer close(cmTerm)
+	watchConfigMapSources(kubeClient, cmTerm)
+
+	log.Debug("Creating watcher for AstroMonitorSets.")
+	amsTerm := make(chan struct{})
+	defer close(amsTerm)
+	go watchAstroMonitorSets(ctx, kubeClient, amsTerm)
 
 	select {
 	case <-ctx.Done():
@@ -186,29 +472,226 @@ func New(ctx context.Context) {
 	}
 }
 
-func getRateLimitTime() int {
-	rateString := os.Getenv("RATELIMIT_INTERVAL")
+// watchGenericResources starts a watcher for every object type in the rulesets that is watched through the
+// dynamic client, and stops the watcher for a type once it is no longer in the rulesets.  Rulesets are checked when
+// they change, and periodically so watchers that failed to start are retried.
+func watchGenericResources(ctx context.Context, kubeClient *kube.ClientInstance, term <-chan struct{}) {
+	watchers := make(map[string]chan struct{})
+	defer func() {
+		for _, stop := range watchers {
+			close(stop)
+		}
+	}()
+
+	changed := make(chan struct{}, 1)
+	removeListener := config.GetInstance().OnRulesetsChanged(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	defer removeListener()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		syncGenericWatchers(ctx, kubeClient, watchers)
+		select {
+		case <-term:
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncGenericWatchers starts a watcher for each generic object type in the rulesets that isn't in watchers, and stops
+// the watchers for types that have left the rulesets.  watchers holds the channel that stops the watcher for each type.
+func syncGenericWatchers(ctx context.Context, kubeClient *kube.ClientInstance, watchers map[string]chan struct{}) {
+	objectTypes := make(map[string]bool)
+	for _, objectType := range config.GetInstance().Rulesets().GetGenericObjectTypes() {
+		objectTypes[objectType] = true
+		if _, found := watchers[objectType]; found {
+			continue
+		}
+		log.Debugf("Creating watcher for %s.", objectType)
+		informer, err := newGenericInformer(kubeClient, objectType)
+		if err != nil {
+			log.Errorf("Error creating watcher for %s: %v", objectType, err)
+			continue
+		}
+		stop := make(chan struct{})
+		watchers[objectType] = stop
+		watcher := createController(kubeClient.Client, informer, objectType)
+		go watcher.Watch(ctx, stop)
+	}
+
+	for objectType, stop := range watchers {
+		if objectTypes[objectType] {
+			continue
+		}
+		log.Infof("Stopping watcher for %s, which is no longer in the rulesets.", objectType)
+		close(stop)
+		delete(watchers, objectType)
+		handler.UnregisterLookup(objectType)
+	}
+}
+
+// watchConfigMapSources starts an informer for each ConfigMap that rulesets are loaded from.  Rulesets are read from
+// the informer caches, and are reloaded as soon as one of the ConfigMaps changes.  Reloads are queued rather than run
+// by the informers, since a reload also fetches the other paths, and changes made while a reload is queued are loaded
+// by that reload.  The channel returned is closed once reloads have stopped after term is closed.
+func watchConfigMapSources(kubeClient *kube.ClientInstance, term <-chan struct{}) <-chan struct{} {
+	cfg := config.GetInstance()
+	reloads := workqueue.New()
+	stopped := make(chan struct{})
+	go func() {
+		<-term
+		reloads.ShutDown()
+	}()
+	go func() {
+		defer close(stopped)
+		for {
+			item, shutdown := reloads.Get()
+			if shutdown {
+				return
+			}
+			cfg.Reload()
+			reloads.Done(item)
+		}
+	}()
+
+	started := make(map[string]bool)
+	for _, source := range cfg.GetConfigMapSources() {
+		key := fmt.Sprintf("%s/%s", source.Namespace, source.Name)
+		if started[key] {
+			continue
+		}
+		started[key] = true
+		log.Debugf("Creating watcher for ConfigMap %s.", key)
+		fieldSelector := fields.OneTermEqualSelector("metadata.name", source.Name).String()
+		namespace := source.Namespace
+		informer := cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return kubeClient.Client.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{FieldSelector: fieldSelector})
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return kubeClient.Client.CoreV1().ConfigMaps(namespace).Watch(context.TODO(), metav1.ListOptions{FieldSelector: fieldSelector})
+				},
+			},
+			&corev1.ConfigMap{},
+			0,
+			cache.Indexers{},
+		)
+		config.RegisterConfigMapStore(source.Namespace, source.Name, informer.GetStore())
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				log.Infof("ConfigMap %s was added, reloading rulesets.", key)
+				reloads.Add(configMapReload)
+			},
+			UpdateFunc: func(old interface{}, new interface{}) {
+				if objectMeta(old).ResourceVersion == objectMeta(new).ResourceVersion {
+					return
+				}
+				log.Infof("ConfigMap %s was updated, reloading rulesets.", key)
+				reloads.Add(configMapReload)
+			},
+			DeleteFunc: func(obj interface{}) {
+				// the reload fails without the ConfigMap, so the rulesets last loaded are kept until it is recreated.
+				log.Warnf("ConfigMap %s was deleted, keeping the rulesets last loaded from it.", key)
+				reloads.Add(configMapReload)
+			},
+		})
+		go informer.Run(term)
+	}
+	return stopped
+}
+
+// configMapReload is the item queued to reload the rulesets when a ConfigMap changes.
+const configMapReload = "reload"
+
+// watchAstroMonitorSets starts a watcher for AstroMonitorSets once their custom resource definition is installed.
+func watchAstroMonitorSets(ctx context.Context, kubeClient *kube.ClientInstance, term <-chan struct{}) {
+	wait.PollImmediateUntil(time.Minute, func() (bool, error) {
+		informer, err := newGenericInformer(kubeClient, config.AstroMonitorSetObjectType)
+		if err != nil {
+			log.Debugf("Not watching AstroMonitorSets: %v", err)
+			return false, nil
+		}
+		watcher := createController(kubeClient.Client, informer, "astromonitorset")
+		go watcher.Watch(ctx, term)
+		return true, nil
+	}, term)
+}
+
+// newGenericInformer returns an informer for an object type written as group/version/kind.
+func newGenericInformer(kubeClient *kube.ClientInstance, objectType string) (cache.SharedIndexInformer, error) {
+	gvk, ok := config.ParseObjectType(objectType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a valid group/version/kind", objectType)
+	}
+	mapping, err := kubeClient.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			// the kinds served are cached, so the kind is only found on the next attempt if it's installed meanwhile.
+			kubeClient.RESTMapper.Reset()
+		}
+		return nil, err
+	}
+	resource := kubeClient.DynamicClient.Resource(mapping.Resource)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return resource.List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return resource.Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&unstructured.Unstructured{},
+		0,
+		cache.Indexers{},
+	), nil
+}
+
+// getResyncRate returns the number of objects per second queued to be reconciled when the rulesets change.
+func getResyncRate() int {
+	rateString := os.Getenv("RESYNC_RATE")
 	if rateString != "" {
 		rateInt, err := strconv.Atoi(rateString)
-		if err != nil {
-			log.Warn("RATELIMIT_INTERVAL not set to a valid integer value", err)
-			return 5000
+		if err != nil || rateInt <= 0 {
+			log.Warn("RESYNC_RATE not set to a valid positive integer value", err)
+			return 5
 		}
 		return rateInt
 	}
-	return 5000
+	return 5
+}
+
+// getResyncInterval returns how often every object is reconciled again, or zero if objects are only reconciled when
+// they or the rulesets change.
+func getResyncInterval() time.Duration {
+	intervalString := os.Getenv("RESYNC_INTERVAL")
+	if intervalString != "" {
+		intervalInt, err := strconv.Atoi(intervalString)
+		if err != nil || intervalInt < 0 {
+			log.Warn("RESYNC_INTERVAL not set to a valid non-negative integer value", err)
+			return 60 * time.Minute
+		}
+		return time.Duration(intervalInt) * time.Minute
+	}
+	return 60 * time.Minute
 }
 
-func createController(kubeClient kubernetes.Interface, informer cache.SharedIndexInformer, resource string, rateLimit int) *KubeResourceWatcher {
+func createController(kubeClient kubernetes.Interface, informer cache.SharedIndexInformer, resource string) *KubeResourceWatcher {
 	log.Debugf("Creating controller for resource type %s", resource)
-	rateLimiter := workqueue.NewMaxOfRateLimiter(
-		// Default is 5 Millisecond base and a max of 1000 seconds.
-		// Raised the base time to 5 seconds * number of tries squared.
-		// TODO make use of Datadog headers to find proper back off time.
-		workqueue.NewItemExponentialFailureRateLimiter(time.Duration(rateLimit)*time.Millisecond, 1000*time.Second),
-		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
-	)
-	wq := workqueue.NewRateLimitingQueue(rateLimiter)
+	// requests are throttled to the Datadog rate limits by the datadog client, across every watcher, so the queue only
+	// backs off objects that failed.
+	wq := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+
+	// make the watched objects available to the lookup template function
+	handler.RegisterLookup(resource, informer.GetIndexer())
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -269,6 +752,8 @@ func createController(kubeClient kubernetes.Interface, informer cache.SharedInde
 		kubeClient: kubeClient,
 		informer:   informer,
 		wq:         wq,
+		resource:   resource,
+		resync:     make(chan struct{}, 1),
 	}
 }
 
@@ -278,8 +763,39 @@ func objectMeta(obj interface{}) metav1.ObjectMeta {
 	switch object := obj.(type) {
 	case *corev1.Namespace:
 		meta = object.ObjectMeta
+	case *corev1.Node:
+		meta = object.ObjectMeta
+	case *corev1.ConfigMap:
+		meta = object.ObjectMeta
+	case *networkingv1.Ingress:
+		meta = object.ObjectMeta
+	case *corev1.Service:
+		meta = object.ObjectMeta
+	case *autoscalingv1.HorizontalPodAutoscaler:
+		meta = object.ObjectMeta
+	case *corev1.PersistentVolumeClaim:
+		meta = object.ObjectMeta
 	case *v1.Deployment:
 		meta = object.ObjectMeta
+	case *v1.StatefulSet:
+		meta = object.ObjectMeta
+	case *v1.DaemonSet:
+		meta = object.ObjectMeta
+	case *batchv1beta1.CronJob:
+		meta = object.ObjectMeta
+	case *batchv1.Job:
+		meta = object.ObjectMeta
+	case *unstructured.Unstructured:
+		meta = metav1.ObjectMeta{
+			Name:            object.GetName(),
+			Namespace:       object.GetNamespace(),
+			UID:             object.GetUID(),
+			ResourceVersion: object.GetResourceVersion(),
+			Generation:      object.GetGeneration(),
+			Labels:          object.GetLabels(),
+			Annotations:     object.GetAnnotations(),
+			OwnerReferences: object.GetOwnerReferences(),
+		}
 	}
 	return meta
 }
@@ -2,23 +2,32 @@ package controller
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"testing"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
+	"github.com/golang/mock/gomock"
 	log "github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
 
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
 	"github.com/fairwindsops/astro/pkg/kube"
 )
 
@@ -37,7 +46,7 @@ func TestCreateDeploymentController(t *testing.T) {
 		0,
 		cache.Indexers{},
 	)
-	DeployWatcher := createController(kubeClient.Client, DeploymentInformer, "deployment", 500)
+	DeployWatcher := createController(kubeClient.Client, DeploymentInformer, "deployment")
 
 	annotations := make(map[string]string, 1)
 	annotations["test"] = "yup"
@@ -71,20 +80,346 @@ func TestNewController(t *testing.T) {
 	go New(ctx)
 
 	time.Sleep(500 * time.Millisecond)
-	var deployPass = false
-	var namespacePass = false
+	started := map[string]bool{
+		"deployment":              false,
+		"statefulset":             false,
+		"daemonset":               false,
+		"cronjob":                 false,
+		"job":                     false,
+		"namespace":               false,
+		"node":                    false,
+		"ingress":                 false,
+		"service":                 false,
+		"horizontalpodautoscaler": false,
+		"persistentvolumeclaim":   false,
+	}
+	for _, log := range hook.AllEntries() {
+		for resource := range started {
+			if log.Message == "Creating controller for resource type "+resource {
+				started[resource] = true
+			}
+		}
+	}
+
+	for resource, pass := range started {
+		assert.Equal(t, true, pass, "Logging did not indicate that the %s controller started.", resource)
+	}
+}
+
+func TestWatchGenericResources(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	_, hook := test.NewNullLogger()
+	log.AddHook(hook)
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+
+	gvr := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, meta.RESTScopeNamespace)
+	kubeClient := kube.SetAndGetMock()
+	kubeClient.RESTMapper = &kube.MockRESTMapper{DefaultRESTMapper: restMapper}
+	kubeClient.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "RolloutList"})
+
+	term := make(chan struct{})
+	defer close(term)
+	go watchGenericResources(context.TODO(), kubeClient, term)
+
+	time.Sleep(500 * time.Millisecond)
+	var rolloutPass = false
 	for _, log := range hook.AllEntries() {
-		if deployPass && namespacePass {
-			break
+		if log.Message == "Creating controller for resource type argoproj.io/v1alpha1/Rollout" {
+			rolloutPass = true
 		}
-		if log.Message == "Creating controller for resource type deployment" {
-			deployPass = true
+	}
+	assert.Equal(t, true, rolloutPass, "Logging did not indicate that the rollout controller started.")
+}
+
+func TestSyncGenericWatchers(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	cfg := config.GetInstance()
+	definitions := cfg.MonitorDefinitionsPath
+	defer func() {
+		cfg.MonitorDefinitionsPath = definitions
+		cfg.Reload()
+	}()
+
+	gvr := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, meta.RESTScopeNamespace)
+	kubeClient := kube.SetAndGetMock()
+	kubeClient.RESTMapper = &kube.MockRESTMapper{DefaultRESTMapper: restMapper}
+	kubeClient.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "RolloutList"})
+
+	watchers := make(map[string]chan struct{})
+	defer func() {
+		for _, stop := range watchers {
+			close(stop)
+		}
+	}()
+	syncGenericWatchers(context.TODO(), kubeClient, watchers)
+	rollouts, found := watchers["argoproj.io/v1alpha1/Rollout"]
+	assert.True(t, found)
+
+	// the watcher is stopped once the type leaves the rulesets.
+	file, err := ioutil.TempFile("", "astro-conf-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	assert.NoError(t, ioutil.WriteFile(file.Name(), []byte("rulesets:\n- type: deployment\n  match_annotations:\n    - name: astro/owner\n      value: astro\n"), 0644))
+	cfg.MonitorDefinitionsPath = []string{file.Name()}
+	assert.NoError(t, cfg.Reload())
+	syncGenericWatchers(context.TODO(), kubeClient, watchers)
+	assert.Empty(t, watchers)
+	select {
+	case <-rollouts:
+	default:
+		t.Error("the watcher for argoproj.io/v1alpha1/Rollout wasn't stopped")
+	}
+
+	// and started again if it comes back.
+	cfg.MonitorDefinitionsPath = definitions
+	assert.NoError(t, cfg.Reload())
+	syncGenericWatchers(context.TODO(), kubeClient, watchers)
+	assert.Contains(t, watchers, "argoproj.io/v1alpha1/Rollout")
+}
+
+func TestNewGenericInformerResetsRESTMapper(t *testing.T) {
+	restMapper := &kube.MockRESTMapper{DefaultRESTMapper: meta.NewDefaultRESTMapper(nil)}
+	kubeClient := kube.SetAndGetMock()
+	kubeClient.RESTMapper = restMapper
+
+	// the kind isn't served yet, so the cached kinds are discarded for the next attempt.
+	_, err := newGenericInformer(kubeClient, "argoproj.io/v1alpha1/Rollout")
+	assert.Error(t, err)
+	assert.Equal(t, 1, restMapper.Resets())
+
+	restMapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, meta.RESTScopeNamespace)
+	_, err = newGenericInformer(kubeClient, "argoproj.io/v1alpha1/Rollout")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, restMapper.Resets())
+}
+
+func TestObjectMetaUnstructured(t *testing.T) {
+	rollout := &unstructured.Unstructured{}
+	rollout.SetAPIVersion("argoproj.io/v1alpha1")
+	rollout.SetKind("Rollout")
+	rollout.SetNamespace("foo")
+	rollout.SetName("bar")
+	rollout.SetAnnotations(map[string]string{"astro/owner": "astro"})
+
+	meta := objectMeta(rollout)
+	assert.Equal(t, "foo", meta.Namespace)
+	assert.Equal(t, "bar", meta.Name)
+	assert.Equal(t, map[string]string{"astro/owner": "astro"}, meta.Annotations)
+}
+
+func TestGenericWatcherReconciles(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	cfg := config.GetInstance()
+	dryRun := cfg.DryRun
+	cfg.DryRun = false
+	defer func() { cfg.DryRun = dryRun }()
+
+	gvr := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, meta.RESTScopeNamespace)
+	rollout := &unstructured.Unstructured{}
+	rollout.SetAPIVersion("argoproj.io/v1alpha1")
+	rollout.SetKind("Rollout")
+	rollout.SetNamespace("foo")
+	rollout.SetName("canary")
+	rollout.SetAnnotations(map[string]string{"astro/owner": "astro"})
+	kubeClient.RESTMapper = &kube.MockRESTMapper{DefaultRESTMapper: restMapper}
+	kubeClient.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "RolloutList"}, rollout)
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}, metav1.CreateOptions{})
+
+	informer, err := newGenericInformer(kubeClient, "argoproj.io/v1alpha1/Rollout")
+	assert.NoError(t, err)
+	watcher := createController(kubeClient.Client, informer, "argoproj.io/v1alpha1/Rollout")
+	term := make(chan struct{})
+	defer close(term)
+	go informer.Run(term)
+	assert.True(t, cache.WaitForCacheSync(term, watcher.HasSynced))
+
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any()).AnyTimes()
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Equal(t, "Rollout Degraded - canary", *monitor.Name)
+			assert.Contains(t, monitor.Tags, "astro:resource:foo/canary")
+		})
+	assert.Equal(t, 1, watcher.wq.Len())
+	assert.True(t, watcher.next(context.TODO()))
+
+	// updates carry the rollout's metadata, so a changed annotation is reconciled rather than dropped as unchanged.
+	rollout.SetAnnotations(map[string]string{"astro/owner": "astro", "astro.fairwinds.com/override.rollout-degraded.threshold-critical": "2"})
+	_, err = kubeClient.DynamicClient.Resource(gvr).Namespace("foo").Update(context.TODO(), rollout, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return watcher.wq.Len() == 1 }, time.Second, 10*time.Millisecond)
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Equal(t, "2", monitor.Options.Thresholds.Critical.String())
+		})
+	assert.True(t, watcher.next(context.TODO()))
+}
+
+func TestWatchAstroMonitorSets(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	_, hook := test.NewNullLogger()
+	log.AddHook(hook)
+
+	gvr := schema.GroupVersionResource{Group: "astro.fairwinds.com", Version: "v1alpha1", Resource: "astromonitorsets"}
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "astro.fairwinds.com", Version: "v1alpha1", Kind: "AstroMonitorSet"}, meta.RESTScopeNamespace)
+	kubeClient := kube.SetAndGetMock()
+	kubeClient.RESTMapper = &kube.MockRESTMapper{DefaultRESTMapper: restMapper}
+	kubeClient.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "AstroMonitorSetList"})
+
+	term := make(chan struct{})
+	defer close(term)
+	go watchAstroMonitorSets(context.TODO(), kubeClient, term)
+
+	time.Sleep(500 * time.Millisecond)
+	var started = false
+	for _, log := range hook.AllEntries() {
+		if log.Message == "Creating controller for resource type astromonitorset" {
+			started = true
 		}
-		if log.Message == "Creating controller for resource type namespace" {
-			namespacePass = true
+	}
+	assert.Equal(t, true, started, "Logging did not indicate that the AstroMonitorSet controller started.")
+}
+
+func TestWatchConfigMapSources(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	cfg := config.GetInstance()
+	definitions := cfg.MonitorDefinitionsPath
+	cfg.MonitorDefinitionsPath = []string{"configmap://astro/rules/conf.yml"}
+	defer func() {
+		cfg.MonitorDefinitionsPath = definitions
+		cfg.Reload()
+	}()
+
+	kubeClient := kube.SetAndGetMock()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rules",
+			Namespace: "astro",
+		},
+		Data: map[string]string{"conf.yml": "rulesets: []"},
+	}
+	kubeClient.Client.CoreV1().ConfigMaps("astro").Create(context.TODO(), configMap, metav1.CreateOptions{})
+
+	term := make(chan struct{})
+	stopped := watchConfigMapSources(kubeClient, term)
+	defer func() {
+		close(term)
+		<-stopped
+	}()
+
+	assert.Eventually(t, func() bool { return len(cfg.Rulesets().MonitorSets) == 0 }, time.Second, 10*time.Millisecond)
+
+	configMap.Data["conf.yml"] = "rulesets:\n- type: deployment\n  match_annotations:\n    - name: astro/owner\n      value: astro\n"
+	configMap.ResourceVersion = "2"
+	kubeClient.Client.CoreV1().ConfigMaps("astro").Update(context.TODO(), configMap, metav1.UpdateOptions{})
+
+	assert.Eventually(t, func() bool { return len(cfg.Rulesets().MonitorSets) == 1 }, time.Second, 10*time.Millisecond)
+
+	// deleting the ConfigMap keeps the rulesets last loaded from it.
+	kubeClient.Client.CoreV1().ConfigMaps("astro").Delete(context.TODO(), "rules", metav1.DeleteOptions{})
+	assert.Never(t, func() bool { return len(cfg.Rulesets().MonitorSets) != 1 }, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+// newResyncWatcher returns a synced deployment watcher for two deployments in a namespace, with an empty queue.
+func newResyncWatcher(t *testing.T, namespace string, term <-chan struct{}) *KubeResourceWatcher {
+	kubeClient := kube.SetAndGetMock()
+	for _, name := range []string{"foo", "bar"} {
+		deploy := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
 		}
+		kubeClient.Client.AppsV1().Deployments(namespace).Create(context.TODO(), deploy, metav1.CreateOptions{})
 	}
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Client.AppsV1().Deployments("").List(context.TODO(), metav1.ListOptions{})
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Client.AppsV1().Deployments("").Watch(context.TODO(), metav1.ListOptions{})
+			},
+		},
+		&appsv1.Deployment{},
+		0,
+		cache.Indexers{},
+	)
+	watcher := createController(kubeClient.Client, informer, "deployment")
+
+	go informer.Run(term)
+	assert.True(t, cache.WaitForCacheSync(term, watcher.HasSynced))
+
+	// drain the events from the initial list, so only resync events are queued.
+	for watcher.wq.Len() > 0 {
+		evt, _ := watcher.wq.Get()
+		watcher.wq.Done(evt)
+	}
+	return watcher
+}
+
+// assertResynced asserts that both deployments in the namespace are queued to be resynced.
+func assertResynced(t *testing.T, watcher *KubeResourceWatcher, namespace string) {
+	assert.Eventually(t, func() bool { return watcher.wq.Len() == 2 }, time.Second, 10*time.Millisecond)
+	keys := []string{}
+	for watcher.wq.Len() > 0 {
+		evt, _ := watcher.wq.Get()
+		event := evt.(config.Event)
+		assert.Equal(t, "resync", event.EventType)
+		assert.Equal(t, "deployment", event.ResourceType)
+		assert.Equal(t, namespace, event.Namespace)
+		keys = append(keys, event.Key)
+		watcher.wq.Done(evt)
+	}
+	assert.ElementsMatch(t, []string{namespace + "/foo", namespace + "/bar"}, keys)
+}
+
+func TestResync(t *testing.T) {
+	term := make(chan struct{})
+	defer close(term)
+	watcher := newResyncWatcher(t, "resync", term)
+	go watcher.resyncLoop(term, 0)
+
+	watcher.Resync()
+	assertResynced(t, watcher, "resync")
+}
+
+func TestResyncInterval(t *testing.T) {
+	term := make(chan struct{})
+	defer close(term)
+	watcher := newResyncWatcher(t, "periodic", term)
+	go watcher.resyncLoop(term, 100*time.Millisecond)
+
+	assertResynced(t, watcher, "periodic")
+	assertResynced(t, watcher, "periodic")
+}
+
+func TestGetResyncInterval(t *testing.T) {
+	defer os.Unsetenv("RESYNC_INTERVAL")
+
+	os.Unsetenv("RESYNC_INTERVAL")
+	assert.Equal(t, 60*time.Minute, getResyncInterval())
+
+	os.Setenv("RESYNC_INTERVAL", "15")
+	assert.Equal(t, 15*time.Minute, getResyncInterval())
+
+	os.Setenv("RESYNC_INTERVAL", "0")
+	assert.Equal(t, time.Duration(0), getResyncInterval())
 
-	assert.Equal(t, true, deployPass, "Logging did not indicate that the deployment controller started.")
-	assert.Equal(t, true, namespacePass, "Logging did not indicate that the namespace controller started.")
+	os.Setenv("RESYNC_INTERVAL", "soon")
+	assert.Equal(t, 60*time.Minute, getResyncInterval())
 }
@@ -0,0 +1,227 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datadog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	ddapi "github.com/zorkian/go-datadog-api"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+// client adds the requests astro makes that go-datadog-api doesn't support to its Client, and cancels the requests of
+// each call when its context is done.
+type client struct {
+	*ddapi.Client
+	apiKey string
+	appKey string
+}
+
+// newClient returns a client for the Datadog API of the site, proxy, certificates and timeout configured.
+func newClient(conf *config.Config) (*client, error) {
+	transport, err := newTransport(conf)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		Client: ddapi.NewClient(conf.DatadogAPIKey, conf.DatadogAppKey),
+		apiKey: conf.DatadogAPIKey,
+		appKey: conf.DatadogAppKey,
+	}
+	c.SetBaseUrl(conf.DatadogBaseURL())
+	// requests are throttled and retried by the transport, across every caller, so the client doesn't retry them too.
+	// Each attempt is timed out separately, so waiting for a rate limit doesn't count against the timeout.
+	var next http.RoundTripper = transport
+	if conf.DatadogTimeout > 0 {
+		next = &timeoutTransport{next: transport, timeout: time.Duration(conf.DatadogTimeout) * time.Second}
+	}
+	c.HttpClient = &http.Client{Transport: newRateLimitTransport(next)}
+	c.RetryTimeout = time.Nanosecond
+	return c, nil
+}
+
+// newTransport returns the transport requests to Datadog are sent with.
+func newTransport(conf *config.Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.DatadogProxyURL != "" {
+		proxy, err := url.Parse(conf.DatadogProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Datadog proxy url: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if conf.DatadogCABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		bundle, err := ioutil.ReadFile(conf.DatadogCABundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading Datadog CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in Datadog CA bundle %s", conf.DatadogCABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return transport, nil
+}
+
+// timeoutTransport cancels a request that hasn't completed, including reading its response body, within its timeout.
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip sends a request that is cancelled once the timeout passes or its response body is closed.
+func (transport *timeoutTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(request.Context(), transport.timeout)
+	response, err := transport.next.RoundTrip(request.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelOnClose is a response body that releases the context of its request when it is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// SetKeys changes the keys used by every request.
+func (c *client) SetKeys(apiKey string, appKey string) {
+	c.Client.SetKeys(apiKey, appKey)
+	c.apiKey = apiKey
+	c.appKey = appKey
+}
+
+// GetMonitorsPage returns a page of the monitors with all of the monitor tags specified.  Pages are numbered from 0.
+func (c *client) GetMonitorsPage(ctx context.Context, tags []string, page int, pageSize int) ([]ddapi.Monitor, error) {
+	query := url.Values{}
+	query.Set("monitor_tags", strings.Join(tags, ","))
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/monitor?%s", c.GetBaseUrl(), query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("DD-API-KEY", c.apiKey)
+	request.Header.Set("DD-APPLICATION-KEY", c.appKey)
+	for header, value := range c.ExtraHeader {
+		request.Header.Set(header, value)
+	}
+
+	response, err := c.HttpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing monitors returned %s", response.Status)
+	}
+
+	var monitors []ddapi.Monitor
+	if err := json.NewDecoder(response.Body).Decode(&monitors); err != nil {
+		return nil, err
+	}
+	return monitors, nil
+}
+
+// CreateMonitor creates a monitor.
+func (c *client) CreateMonitor(ctx context.Context, monitor *ddapi.Monitor) (*ddapi.Monitor, error) {
+	return c.withContext(ctx).CreateMonitor(monitor)
+}
+
+// DeleteMonitor deletes a monitor.
+func (c *client) DeleteMonitor(ctx context.Context, id int) error {
+	return c.withContext(ctx).DeleteMonitor(id)
+}
+
+// MuteMonitorScope mutes a monitor for a scope.
+func (c *client) MuteMonitorScope(ctx context.Context, id int, muteMonitorScope *ddapi.MuteMonitorScope) error {
+	return c.withContext(ctx).MuteMonitorScope(id, muteMonitorScope)
+}
+
+// UnmuteMonitor unmutes a monitor.
+func (c *client) UnmuteMonitor(ctx context.Context, id int) error {
+	return c.withContext(ctx).UnmuteMonitor(id)
+}
+
+// UpdateMonitor updates a monitor.
+func (c *client) UpdateMonitor(ctx context.Context, monitor *ddapi.Monitor) error {
+	return c.withContext(ctx).UpdateMonitor(monitor)
+}
+
+// CreateSyntheticsTest creates a synthetics test.
+func (c *client) CreateSyntheticsTest(ctx context.Context, syntheticsTest *ddapi.SyntheticsTest) (*ddapi.SyntheticsTest, error) {
+	return c.withContext(ctx).CreateSyntheticsTest(syntheticsTest)
+}
+
+// DeleteSyntheticsTests deletes synthetics tests.
+func (c *client) DeleteSyntheticsTests(ctx context.Context, publicIds []string) error {
+	return c.withContext(ctx).DeleteSyntheticsTests(publicIds)
+}
+
+// GetSyntheticsTests returns every synthetics test.
+func (c *client) GetSyntheticsTests(ctx context.Context) ([]ddapi.SyntheticsTest, error) {
+	return c.withContext(ctx).GetSyntheticsTests()
+}
+
+// UpdateSyntheticsTest updates a synthetics test.
+func (c *client) UpdateSyntheticsTest(ctx context.Context, publicId string, syntheticsTest *ddapi.SyntheticsTest) (*ddapi.SyntheticsTest, error) {
+	return c.withContext(ctx).UpdateSyntheticsTest(publicId, syntheticsTest)
+}
+
+// withContext returns a go-datadog-api client like c whose requests are sent with the context, as go-datadog-api
+// doesn't take one.
+func (c *client) withContext(ctx context.Context) *ddapi.Client {
+	requestClient := ddapi.NewClient(c.apiKey, c.appKey)
+	requestClient.SetBaseUrl(c.GetBaseUrl())
+	requestClient.HttpClient = &http.Client{Transport: contextTransport{ctx: ctx, next: c.HttpClient.Transport}}
+	requestClient.RetryTimeout = c.RetryTimeout
+	requestClient.ExtraHeader = c.ExtraHeader
+	return requestClient
+}
+
+// contextTransport sends every request with its context.
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (transport contextTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return transport.next.RoundTrip(request.WithContext(transport.ctx))
+}
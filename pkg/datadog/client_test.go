@@ -0,0 +1,123 @@
+package datadog
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+func TestNewClientSite(t *testing.T) {
+	client, err := newClient(&config.Config{DatadogSite: "datadoghq.eu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.datadoghq.eu", client.GetBaseUrl())
+}
+
+func TestNewClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("[]"))
+	}))
+	defer proxy.Close()
+
+	client, err := newClient(&config.Config{DatadogAPIURL: "http://datadog.example", DatadogProxyURL: proxy.URL})
+	assert.NoError(t, err)
+	_, err = client.GetMonitorsPage(context.TODO(), []string{"astro"}, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://datadog.example/api/v1/monitor?monitor_tags=astro&page=0&page_size=10", proxied)
+
+	_, err = newClient(&config.Config{DatadogProxyURL: "://proxy"})
+	assert.Error(t, err)
+}
+
+func TestNewClientCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	// the server's certificate isn't trusted without the bundle.
+	client, err := newClient(&config.Config{DatadogAPIURL: server.URL})
+	assert.NoError(t, err)
+	_, err = client.GetMonitorsPage(context.TODO(), []string{"astro"}, 0, 10)
+	assert.Error(t, err)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, ioutil.WriteFile(bundle, certificate, 0600))
+	client, err = newClient(&config.Config{DatadogAPIURL: server.URL, DatadogCABundle: bundle})
+	assert.NoError(t, err)
+	_, err = client.GetMonitorsPage(context.TODO(), []string{"astro"}, 0, 10)
+	assert.NoError(t, err)
+
+	_, err = newClient(&config.Config{DatadogCABundle: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	assert.NoError(t, ioutil.WriteFile(empty, []byte("not a certificate"), 0600))
+	_, err = newClient(&config.Config{DatadogCABundle: empty})
+	assert.Error(t, err)
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client, err := newClient(&config.Config{DatadogAPIURL: server.URL, DatadogTimeout: 1})
+	assert.NoError(t, err)
+	start := time.Now()
+	_, err = client.GetMonitorsPage(context.TODO(), []string{"astro"}, 0, 10)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
+func TestNewClientBodyTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the headers are sent, but the body stalls.
+		w.Write([]byte("["))
+		w.(http.Flusher).Flush()
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client, err := newClient(&config.Config{DatadogAPIURL: server.URL, DatadogTimeout: 1})
+	assert.NoError(t, err)
+	start := time.Now()
+	_, err = client.GetMonitorsPage(context.TODO(), []string{"astro"}, 0, 10)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
+func TestClientCancelled(t *testing.T) {
+	fake, client := newFakeDatadog(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.CreateMonitor(ctx, &ddapi.Monitor{Name: ddapi.String("foo")})
+	assert.Error(t, err)
+	_, err = client.GetSyntheticsTests(ctx)
+	assert.Error(t, err)
+	_, err = client.GetMonitorsPage(ctx, []string{"astro"}, 0, 10)
+	assert.Error(t, err)
+	assert.Empty(t, fake.requests)
+
+	tests, err := client.GetSyntheticsTests(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, tests)
+	assert.Equal(t, 1, fake.count("GET /api/v1/synthetics/tests"))
+}
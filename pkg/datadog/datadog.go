@@ -15,9 +15,14 @@
 package datadog
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/imdario/mergo"
 	log "github.com/sirupsen/logrus"
@@ -27,20 +32,32 @@ import (
 	"github.com/fairwindsops/astro/pkg/metrics"
 )
 
-// ClientAPI defines the interface for the Datadog client, for testing purposes
+// ClientAPI defines the interface for the Datadog client, for testing purposes.  Requests are cancelled when their
+// context is done.
 type ClientAPI interface {
-	CreateMonitor(*ddapi.Monitor) (*ddapi.Monitor, error)
-	DeleteMonitor(id int) error
-	GetMonitorsByMonitorTags(tags []string) ([]ddapi.Monitor, error)
-	MuteMonitorScope(id int, muteMonitorScope *ddapi.MuteMonitorScope) error
-	UnmuteMonitor(id int) error
-	UpdateMonitor(*ddapi.Monitor) error
+	CreateMonitor(ctx context.Context, monitor *ddapi.Monitor) (*ddapi.Monitor, error)
+	DeleteMonitor(ctx context.Context, id int) error
+	GetMonitorsPage(ctx context.Context, tags []string, page int, pageSize int) ([]ddapi.Monitor, error)
+	MuteMonitorScope(ctx context.Context, id int, muteMonitorScope *ddapi.MuteMonitorScope) error
+	UnmuteMonitor(ctx context.Context, id int) error
+	UpdateMonitor(ctx context.Context, monitor *ddapi.Monitor) error
+	CreateSyntheticsTest(ctx context.Context, syntheticsTest *ddapi.SyntheticsTest) (*ddapi.SyntheticsTest, error)
+	DeleteSyntheticsTests(ctx context.Context, publicIds []string) error
+	GetSyntheticsTests(ctx context.Context) ([]ddapi.SyntheticsTest, error)
+	UpdateSyntheticsTest(ctx context.Context, publicId string, syntheticsTest *ddapi.SyntheticsTest) (*ddapi.SyntheticsTest, error)
 }
 
+// callTimeout is the longest a call to the Datadog API may take, including its retries and waits for rate limits, so
+// a call that hangs doesn't hold ddman.mux forever.
+const callTimeout = 5 * time.Minute
+
 // DDMonitorManager is a higher-level wrapper around the Datadog API
 type DDMonitorManager struct {
-	Datadog ClientAPI
-	mux     sync.Mutex
+	Datadog  ClientAPI
+	mux      sync.Mutex
+	applied  map[string][]byte     // The desired monitors last applied to Datadog by name, used to detect drift
+	monitors map[int]ddapi.Monitor // The index of monitors managed by astro by id, or nil until they are listed
+	listed   time.Time             // When the monitors in the index were last listed
 }
 
 var ddMonitorManagerInstance *DDMonitorManager
@@ -48,9 +65,12 @@ var ddMonitorManagerInstance *DDMonitorManager
 // GetInstance returns a singleton DDMonitorManager, creating it if necessary
 func GetInstance() *DDMonitorManager {
 	if ddMonitorManagerInstance == nil {
-		conf := config.GetInstance()
+		client, err := newClient(config.GetInstance())
+		if err != nil {
+			log.Fatalf("Error creating Datadog client: %v", err)
+		}
 		ddMonitorManagerInstance = &DDMonitorManager{
-			Datadog: ddapi.NewClient(conf.DatadogAPIKey, conf.DatadogAppKey),
+			Datadog: client,
 		}
 	}
 	return ddMonitorManagerInstance
@@ -58,23 +78,45 @@ func GetInstance() *DDMonitorManager {
 
 // AddOrUpdate will create a monitor if it doesn't exist or update one if it does.
 // It returns the Id of the monitor created or updated.
-func (ddman *DDMonitorManager) AddOrUpdate(monitor *ddapi.Monitor) (*ddapi.Monitor, error) {
+func (ddman *DDMonitorManager) AddOrUpdate(ctx context.Context, monitor *ddapi.Monitor) (*ddapi.Monitor, error) {
 	log.Debugf("Update templated monitor: %v", *monitor.Name)
 	ddman.mux.Lock()
 	defer ddman.mux.Unlock()
 
+	// the monitor is copied before it's merged, as merging fills in its options.
+	desired, err := json.Marshal(monitor)
+	if err != nil {
+		return nil, err
+	}
+	previous, wasApplied := ddman.applied[appliedKey(*monitor)]
+	unchanged := wasApplied && string(previous) == string(desired)
+
 	// check if monitor exists
-	ddMonitor, err := ddman.GetProvisionedMonitor(monitor)
+	ddMonitor, err := ddman.findMonitor(ctx, monitor)
 	if err != nil {
+		return nil, err
+	}
+	if ddMonitor == nil {
 		// monitor doesn't exist
+		if unchanged {
+			metrics.DriftCounter.WithLabelValues("missing").Inc()
+			log.Warnf("Monitor %v was deleted outside of astro, recreating it", *monitor.Name)
+		}
 		log.Infof("Creating new monitor: %v", *monitor.Name)
-		provisioned, err := ddman.Datadog.CreateMonitor(monitor)
+		callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+		provisioned, err := ddman.Datadog.CreateMonitor(callCtx, monitor)
+		cancel()
 
 		if err != nil {
 			metrics.DatadogErrCounter.Inc()
 			log.Errorf("Error creating monitor %s: %s", *monitor.Name, err)
+			ddman.invalidateIndex()
 			return nil, err
 		}
+		if provisioned != nil {
+			ddman.indexMonitor(*provisioned)
+		}
+		ddman.setApplied(appliedKey(*monitor), desired)
 		return provisioned, nil
 	}
 
@@ -87,53 +129,174 @@ func (ddman *DDMonitorManager) AddOrUpdate(monitor *ddapi.Monitor) (*ddapi.Monit
 		log.Debugf("Monitor exists and is up to date: %v", *ddMonitor.Name)
 	} else {
 		// monitor exists and needs updating.
-		log.Infof("Monitor updating: %v", *ddMonitor.Name)
-		err := ddman.Datadog.UpdateMonitor(merged)
+		fields := strings.Join(changedFields(*ddMonitor, *merged), ", ")
+		if unchanged {
+			metrics.DriftCounter.WithLabelValues("changed").Inc()
+			log.Warnf("Monitor %v was changed outside of astro, reverting fields: %s", *ddMonitor.Name, fields)
+		} else {
+			log.Infof("Monitor updating: %v, changed fields: %s", *ddMonitor.Name, fields)
+		}
+		callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+		err := ddman.Datadog.UpdateMonitor(callCtx, merged)
+		cancel()
 		if err != nil {
 			metrics.DatadogErrCounter.Inc()
 			log.Errorf("Could not update monitor: %v, error: %s", *ddMonitor.Name, err)
+			ddman.invalidateIndex()
 			return ddMonitor, err
 		}
+		ddman.indexMonitor(*merged)
+	}
+	ddman.setApplied(appliedKey(*monitor), desired)
+	return ddMonitor, nil
+}
+
+// setApplied records the desired monitor that Datadog matches.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) setApplied(key string, desired []byte) {
+	if ddman.applied == nil {
+		ddman.applied = make(map[string][]byte)
+	}
+	ddman.applied[key] = desired
+}
+
+// forgetApplied stops detecting drift for a monitor that astro deleted, so it isn't reported as missing if it's
+// created again.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) forgetApplied(monitor ddapi.Monitor) {
+	delete(ddman.applied, appliedKey(monitor))
+}
+
+// appliedKey returns the key of a monitor in the applied monitors, which is its identity or else its name.
+func appliedKey(monitor ddapi.Monitor) string {
+	if identity := monitorIdentity(monitor); identity != "" {
+		return identity
+	}
+	if monitor.Name != nil {
+		return *monitor.Name
+	}
+	return ""
+}
+
+// monitorIdentity returns the identity tags of a monitor, in lower case and sorted, or "" if it wasn't tagged with its
+// key in its ruleset.  Monitors created by older versions of astro aren't tagged.
+func monitorIdentity(monitor ddapi.Monitor) string {
+	var identity []string
+	var tagged bool
+	for _, tag := range monitor.Tags {
+		tag = strings.ToLower(tag)
+		for _, prefix := range config.IdentityTagPrefixes {
+			if strings.HasPrefix(tag, prefix) {
+				identity = append(identity, tag)
+				break
+			}
+		}
+		tagged = tagged || strings.HasPrefix(tag, config.MonitorTagPrefix)
+	}
+	if !tagged {
+		return ""
+	}
+	sort.Strings(identity)
+	return strings.Join(identity, ",")
+}
+
+// sameMonitor returns whether a monitor in Datadog is the desired monitor.  Monitors are matched by identity, so a
+// monitor whose name changes is updated rather than replaced, or by name if either monitor isn't tagged with its
+// identity.
+func sameMonitor(existing ddapi.Monitor, desired ddapi.Monitor) bool {
+	existingIdentity, desiredIdentity := monitorIdentity(existing), monitorIdentity(desired)
+	if existingIdentity != "" && desiredIdentity != "" {
+		return existingIdentity == desiredIdentity
+	}
+	return existing.Name != nil && desired.Name != nil && *existing.Name == *desired.Name
+}
+
+// changedFields returns the JSON paths of the fields that differ between two monitors, such as options.thresholds.
+func changedFields(current, desired ddapi.Monitor) []string {
+	var currentFields, desiredFields map[string]interface{}
+	if data, err := json.Marshal(current); err == nil {
+		json.Unmarshal(data, &currentFields)
+	}
+	if data, err := json.Marshal(desired); err == nil {
+		json.Unmarshal(data, &desiredFields)
+	}
+	fields := diffFields("", currentFields, desiredFields)
+	sort.Strings(fields)
+	return fields
+}
+
+func diffFields(prefix string, current, desired map[string]interface{}) []string {
+	var fields []string
+	for key, currentValue := range current {
+		currentMap, currentIsMap := currentValue.(map[string]interface{})
+		desiredMap, desiredIsMap := desired[key].(map[string]interface{})
+		if currentIsMap && desiredIsMap {
+			fields = append(fields, diffFields(prefix+key+".", currentMap, desiredMap)...)
+		} else if !reflect.DeepEqual(currentValue, desired[key]) {
+			fields = append(fields, prefix+key)
+		}
+	}
+	for key := range desired {
+		if _, found := current[key]; !found {
+			fields = append(fields, prefix+key)
+		}
+	}
+	return fields
+}
+
+// GetProvisionedMonitor returns the monitor from Datadog with the same identity, or the same name if it has no identity.
+func (ddman *DDMonitorManager) GetProvisionedMonitor(ctx context.Context, monitor *ddapi.Monitor) (*ddapi.Monitor, error) {
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+	ddMonitor, err := ddman.findMonitor(ctx, monitor)
+	if err != nil {
+		return nil, err
+	}
+	if ddMonitor == nil {
+		return nil, errors.New("monitor does not exist")
 	}
 	return ddMonitor, nil
 }
 
-// GetProvisionedMonitor returns a monitor with the same name from Datadog.
-func (ddman *DDMonitorManager) GetProvisionedMonitor(monitor *ddapi.Monitor) (*ddapi.Monitor, error) {
-	monitors, err := ddman.GetProvisionedMonitors()
+// findMonitor returns the monitor in the index that is the monitor desired, or nil if there isn't one.  The caller must
+// hold ddman.mux.
+func (ddman *DDMonitorManager) findMonitor(ctx context.Context, monitor *ddapi.Monitor) (*ddapi.Monitor, error) {
+	monitors, err := ddman.provisionedMonitors(ctx)
 	if err != nil {
-		metrics.DatadogErrCounter.Inc()
 		log.Errorf("Error getting monitors: %v", err)
 		return nil, err
 	}
 
 	for _, ddMonitor := range monitors {
-		if *ddMonitor.Name == *monitor.Name {
+		if sameMonitor(ddMonitor, *monitor) {
 			return &ddMonitor, nil
 		}
 	}
-	return nil, errors.New("monitor does not exist")
+	return nil, nil
 }
 
 // GetProvisionedMonitors returns a collection of monitors managed by astro.
-func (ddman *DDMonitorManager) GetProvisionedMonitors() ([]ddapi.Monitor, error) {
-	return ddman.Datadog.GetMonitorsByMonitorTags([]string{config.GetInstance().OwnerTag})
+func (ddman *DDMonitorManager) GetProvisionedMonitors(ctx context.Context) ([]ddapi.Monitor, error) {
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+	return ddman.provisionedMonitors(ctx)
 }
 
 // DeleteMonitor deletes a monitor
-func (ddman *DDMonitorManager) DeleteMonitor(monitor *ddapi.Monitor) error {
-	ddMonitor, err := ddman.GetProvisionedMonitor(monitor)
-	if err != nil {
-		return ddman.Datadog.DeleteMonitor(*ddMonitor.Id)
+func (ddman *DDMonitorManager) DeleteMonitor(ctx context.Context, monitor *ddapi.Monitor) error {
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+	ddMonitor, err := ddman.findMonitor(ctx, monitor)
+	if err != nil || ddMonitor == nil {
+		return err
 	}
-	return nil
+	return ddman.deleteMonitor(ctx, *ddMonitor)
 }
 
 // DeleteMonitors deletes monitors containing the specified tags.
-func (ddman *DDMonitorManager) DeleteMonitors(tags []string) error {
-	monitors, err := ddman.Datadog.GetMonitorsByMonitorTags(tags)
+func (ddman *DDMonitorManager) DeleteMonitors(ctx context.Context, tags []string) error {
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+	monitors, err := ddman.taggedMonitors(ctx, tags)
 	if err != nil {
-		metrics.DatadogErrCounter.Inc()
 		return err
 	}
 
@@ -141,7 +304,7 @@ func (ddman *DDMonitorManager) DeleteMonitors(tags []string) error {
 
 	for _, ddMonitor := range monitors {
 		log.Infof("Deleting monitor with id %d", *ddMonitor.Id)
-		err := ddman.Datadog.DeleteMonitor(*ddMonitor.Id)
+		err := ddman.deleteMonitor(ctx, ddMonitor)
 		if err != nil {
 			return err
 		}
@@ -150,11 +313,12 @@ func (ddman *DDMonitorManager) DeleteMonitors(tags []string) error {
 }
 
 // DeleteExtinctMonitors gathers monitors configured with all tags in variable tags;  If any are not present in variable monitors they get deleted.
-func DeleteExtinctMonitors(monitors []string, tags []string) error {
+func DeleteExtinctMonitors(ctx context.Context, monitors []ddapi.Monitor, tags []string) error {
 	ddMan := GetInstance()
-	existing, err := ddMan.Datadog.GetMonitorsByMonitorTags(tags)
+	ddMan.mux.Lock()
+	defer ddMan.mux.Unlock()
+	existing, err := ddMan.taggedMonitors(ctx, tags)
 	if err != nil {
-		metrics.DatadogErrCounter.Inc()
 		log.Infof("Error getting monitors: %v", err)
 		return err
 	}
@@ -163,7 +327,7 @@ func DeleteExtinctMonitors(monitors []string, tags []string) error {
 		if !contains(monitors, monitor) {
 			// monitor should no longer exist
 			log.Infof("Removing monitor: %v", *monitor.Name)
-			err = ddMan.Datadog.DeleteMonitor(*monitor.Id)
+			err = ddMan.deleteMonitor(ctx, monitor)
 			if err != nil {
 				metrics.DatadogErrCounter.Inc()
 				log.Warnf("Error deleting extinct monitor %d: %v", *monitor.Id, err)
@@ -174,6 +338,20 @@ func DeleteExtinctMonitors(monitors []string, tags []string) error {
 	return nil
 }
 
+// deleteMonitor deletes a monitor from Datadog and the index.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) deleteMonitor(ctx context.Context, monitor ddapi.Monitor) error {
+	callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	err := ddman.Datadog.DeleteMonitor(callCtx, *monitor.Id)
+	if err != nil {
+		ddman.invalidateIndex()
+		return err
+	}
+	ddman.unindexMonitor(*monitor.Id)
+	ddman.forgetApplied(monitor)
+	return nil
+}
+
 // mergeMonitors fills in zero/nil values in our proposed monitor with values that already exist from the DD API
 func mergeMonitors(newMon, baseMon ddapi.Monitor) (*ddapi.Monitor, error) {
 	err := mergo.Merge(newMon.Options, baseMon.Options)
@@ -186,15 +364,18 @@ func mergeMonitors(newMon, baseMon ddapi.Monitor) (*ddapi.Monitor, error) {
 	if err != nil {
 		return &ddapi.Monitor{}, err
 	}
+	// the state is set by Datadog, so it isn't a change to the monitor.
 	newMon.OverallState = baseMon.OverallState
+	newMon.OverallStateModified = baseMon.OverallStateModified
+	newMon.State = baseMon.State
 	newMon.Id = baseMon.Id
 	return &newMon, nil
 }
 
-// contains returns a boolean indicating whether a collection of strings contains a monitor with the name of monitor item.
-func contains(collection []string, item ddapi.Monitor) bool {
-	for _, name := range collection {
-		if name == *item.Name {
+// contains returns a boolean indicating whether a collection of desired monitors contains the monitor item.
+func contains(collection []ddapi.Monitor, item ddapi.Monitor) bool {
+	for _, monitor := range collection {
+		if sameMonitor(item, monitor) {
 			return true
 		}
 	}
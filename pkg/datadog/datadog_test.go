@@ -0,0 +1,281 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+
+	"github.com/fairwindsops/astro/pkg/metrics"
+	mocks "github.com/fairwindsops/astro/pkg/mocks"
+)
+
+func newMonitor(query string, message string) *ddapi.Monitor {
+	return &ddapi.Monitor{
+		Name:    ddapi.String("deploy foo replicas"),
+		Type:    ddapi.String("metric alert"),
+		Query:   ddapi.String(query),
+		Message: ddapi.String(message),
+		Tags:    []string{"astro"},
+		Options: &ddapi.Options{NotifyNoData: ddapi.Bool(true)},
+	}
+}
+
+// provisioned returns a monitor as Datadog returns it.
+func provisioned(monitor *ddapi.Monitor) ddapi.Monitor {
+	result := *monitor
+	options := *monitor.Options
+	result.Options = &options
+	result.Id = ddapi.Int(1)
+	result.Creator = &ddapi.Creator{}
+	result.OverallState = ddapi.String("OK")
+	result.OverallStateModified = ddapi.String("2020-01-01T00:00:00+00:00")
+	return result
+}
+
+func TestAddOrUpdateDrift(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ddMock := mocks.NewMockClientAPI(ctrl)
+	ddman := &DDMonitorManager{Datadog: ddMock}
+	changed := testutil.ToFloat64(metrics.DriftCounter.WithLabelValues("changed"))
+	missing := testutil.ToFloat64(metrics.DriftCounter.WithLabelValues("missing"))
+
+	// a new monitor is created, which isn't drift.
+	current := provisioned(newMonitor("avg:replicas{*} < 1", "down"))
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{}, nil)
+	ddMock.EXPECT().CreateMonitor(gomock.Any(), gomock.Any()).Return(&current, nil)
+	_, err := ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "down"))
+	assert.NoError(t, err)
+
+	// a monitor that matches the index isn't updated, and the monitors aren't listed again.
+	_, err = ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "down"))
+	assert.NoError(t, err)
+
+	// a monitor edited in Datadog is reverted once the index is refreshed.
+	edited := provisioned(newMonitor("avg:replicas{*} < 0", "down"))
+	ddman.listed = time.Time{}
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{edited}, nil)
+	ddMock.EXPECT().UpdateMonitor(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, monitor *ddapi.Monitor) error {
+		assert.Equal(t, "avg:replicas{*} < 1", *monitor.Query)
+		return nil
+	})
+	_, err = ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "down"))
+	assert.NoError(t, err)
+	assert.Equal(t, changed+1, testutil.ToFloat64(metrics.DriftCounter.WithLabelValues("changed")))
+
+	// a monitor deleted in Datadog is recreated.
+	ddman.listed = time.Time{}
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{}, nil)
+	ddMock.EXPECT().CreateMonitor(gomock.Any(), gomock.Any()).Return(&current, nil)
+	_, err = ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "down"))
+	assert.NoError(t, err)
+	assert.Equal(t, missing+1, testutil.ToFloat64(metrics.DriftCounter.WithLabelValues("missing")))
+
+	// a change to the desired monitor is an update, not drift.
+	ddMock.EXPECT().UpdateMonitor(gomock.Any(), gomock.Any()).Return(nil)
+	_, err = ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "replicas are down"))
+	assert.NoError(t, err)
+	assert.Equal(t, changed+1, testutil.ToFloat64(metrics.DriftCounter.WithLabelValues("changed")))
+	assert.Equal(t, missing+1, testutil.ToFloat64(metrics.DriftCounter.WithLabelValues("missing")))
+	assert.Equal(t, "replicas are down", *ddman.monitors[1].Message)
+}
+
+func TestAddOrUpdateDeadline(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ddMock := mocks.NewMockClientAPI(ctrl)
+	ddman := &DDMonitorManager{Datadog: ddMock}
+
+	// every call has a deadline, and is cancelled with the context of the caller.
+	ctx, cancel := context.WithCancel(context.Background())
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).DoAndReturn(func(ctx context.Context, tags []string, page int, pageSize int) ([]ddapi.Monitor, error) {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		return []ddapi.Monitor{}, nil
+	})
+	ddMock.EXPECT().CreateMonitor(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, monitor *ddapi.Monitor) (*ddapi.Monitor, error) {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		cancel()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	_, err := ddman.AddOrUpdate(ctx, newMonitor("avg:replicas{*} < 1", "down"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, ddman.monitors)
+}
+
+func TestAddOrUpdateError(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ddMock := mocks.NewMockClientAPI(ctrl)
+	ddman := &DDMonitorManager{Datadog: ddMock}
+
+	// monitors aren't created when they can't be listed.
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return(nil, errors.New("unavailable"))
+	_, err := ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "down"))
+	assert.Error(t, err)
+
+	// the monitors are listed again after a failed write.
+	current := provisioned(newMonitor("avg:replicas{*} < 0", "down"))
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{current}, nil).Times(2)
+	ddMock.EXPECT().UpdateMonitor(gomock.Any(), gomock.Any()).Return(errors.New("unavailable"))
+	_, err = ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "down"))
+	assert.Error(t, err)
+	ddMock.EXPECT().UpdateMonitor(gomock.Any(), gomock.Any()).Return(nil)
+	_, err = ddman.AddOrUpdate(context.TODO(), newMonitor("avg:replicas{*} < 1", "down"))
+	assert.NoError(t, err)
+}
+
+func TestListMonitorsPages(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ddMock := mocks.NewMockClientAPI(ctrl)
+	ddman := &DDMonitorManager{Datadog: ddMock}
+
+	page := make([]ddapi.Monitor, monitorPageSize)
+	for i := range page {
+		page[i] = ddapi.Monitor{Id: ddapi.Int(i + 1), Tags: []string{"astro", "astro:object_type:deployment"}}
+	}
+	last := []ddapi.Monitor{{Id: ddapi.Int(monitorPageSize + 1), Tags: []string{"astro", "astro:object_type:argoproj.io/v1alpha1/rollout"}}}
+	first := ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return(page, nil)
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 1, monitorPageSize).Return(last, nil).After(first)
+
+	monitors, err := ddman.GetProvisionedMonitors(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, monitorPageSize+1, len(monitors))
+	assert.Equal(t, 1, *monitors[0].Id)
+
+	// tags are compared without case, as Datadog stores them in lower case.
+	ddman.mux.Lock()
+	tagged, err := ddman.taggedMonitors(context.TODO(), []string{"astro", "astro:object_type:argoproj.io/v1alpha1/Rollout"})
+	ddman.mux.Unlock()
+	assert.NoError(t, err)
+	assert.Equal(t, last, tagged)
+}
+
+func TestChangedFields(t *testing.T) {
+	current := provisioned(newMonitor("avg:replicas{*} < 1", "down"))
+	desired := provisioned(newMonitor("avg:replicas{*} < 0", "down"))
+	desired.Options.NotifyNoData = ddapi.Bool(false)
+	desired.Options.RenotifyInterval = ddapi.Int(10)
+
+	assert.Equal(t, []string{"options.notify_no_data", "options.renotify_interval", "query"}, changedFields(current, desired))
+	assert.Empty(t, changedFields(current, current))
+}
+
+func TestAddOrUpdateRenamed(t *testing.T) {
+	os.Setenv("DEFINITIONS_PATH", "../config/test_conf.yml")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ddMock := mocks.NewMockClientAPI(ctrl)
+	ddman := &DDMonitorManager{Datadog: ddMock}
+	identity := []string{"astro", "astro:ruleset:team_deployments", "astro:monitor:replicas", "astro:uid:0a1b2c"}
+
+	// a monitor with the same identity is renamed in place.
+	existing := provisioned(newMonitor("avg:replicas{*} < 1", "down"))
+	existing.Tags = identity
+	other := provisioned(newMonitor("avg:replicas{*} < 1", "down"))
+	other.Id = ddapi.Int(2)
+	other.Name = ddapi.String("deploy bar replicas")
+	other.Tags = []string{"astro", "astro:ruleset:team_deployments", "astro:monitor:replicas", "astro:uid:3d4e5f"}
+	desired := newMonitor("avg:replicas{*} < 1", "down")
+	desired.Name = ddapi.String("Deployment foo replicas")
+	desired.Tags = identity
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{other, existing}, nil)
+	ddMock.EXPECT().UpdateMonitor(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, monitor *ddapi.Monitor) error {
+		assert.Equal(t, 1, *monitor.Id)
+		assert.Equal(t, "Deployment foo replicas", *monitor.Name)
+		return nil
+	})
+	_, err := ddman.AddOrUpdate(context.TODO(), desired)
+	assert.NoError(t, err)
+
+	// a monitor created before monitors were tagged with their identity is found by name, and tagged.
+	untagged := provisioned(newMonitor("avg:replicas{*} < 1", "down"))
+	untagged.Tags = []string{"astro"}
+	ddman.listed = time.Time{}
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{other, untagged}, nil)
+	ddMock.EXPECT().UpdateMonitor(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, monitor *ddapi.Monitor) error {
+		assert.Equal(t, 1, *monitor.Id)
+		assert.Equal(t, identity, monitor.Tags)
+		return nil
+	})
+	desired = newMonitor("avg:replicas{*} < 1", "down")
+	desired.Tags = identity
+	_, err = ddman.AddOrUpdate(context.TODO(), desired)
+	assert.NoError(t, err)
+}
+
+func TestDeleteExtinctMonitorsIdentity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ddMock := GetMock(ctrl)
+
+	renamed := provisioned(newMonitor("avg:replicas{*} < 1", "down"))
+	renamed.Tags = []string{"astro", "astro:ruleset:team_deployments", "astro:monitor:replicas", "astro:uid:0a1b2c"}
+	extinct := provisioned(newMonitor("avg:replicas{*} < 1", "down"))
+	extinct.Id = ddapi.Int(2)
+	extinct.Tags = []string{"astro", "astro:ruleset:team_deployments", "astro:monitor:pods", "astro:uid:0a1b2c"}
+	desired := newMonitor("avg:replicas{*} < 1", "down")
+	desired.Name = ddapi.String("Deployment foo replicas")
+	desired.Tags = renamed.Tags
+
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{renamed, extinct}, nil)
+	ddMock.EXPECT().DeleteMonitor(gomock.Any(), 2).Return(nil)
+	assert.NoError(t, DeleteExtinctMonitors(context.TODO(), []ddapi.Monitor{*desired}, []string{"astro"}))
+}
+
+func TestDeleteExtinctMonitorsSyntheticsAlert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ddMock := GetMock(ctrl)
+
+	// the monitor of a synthetics test carries the tags of the test, which are those of the ingress's monitors.
+	tags := []string{"astro", "astro:object_type:ingress", "astro:resource:foo/web"}
+	alert := provisioned(newMonitor("synthetics(abc-123)", "down"))
+	alert.Type = ddapi.String("synthetics alert")
+	alert.Tags = append(tags, "astro:synthetics:up")
+
+	// it isn't managed as a monitor, so it isn't deleted as extinct.
+	ddMock.EXPECT().GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, monitorPageSize).Return([]ddapi.Monitor{alert}, nil)
+	assert.NoError(t, DeleteExtinctMonitors(context.TODO(), []ddapi.Monitor{}, tags))
+}
+
+func TestMonitorIdentity(t *testing.T) {
+	named := ddapi.Monitor{Tags: []string{"astro", "astro:monitor:replicas", "Astro:Ruleset:team_deployments", "astro:uid:0a1b2c"}}
+	assert.Equal(t, "astro:monitor:replicas,astro:ruleset:team_deployments,astro:uid:0a1b2c", monitorIdentity(named))
+
+	// monitors of unnamed rulesets are identified without their ruleset.
+	unnamed := ddapi.Monitor{Tags: []string{"astro", "astro:monitor:replicas", "astro:uid:0a1b2c"}}
+	assert.Equal(t, "astro:monitor:replicas,astro:uid:0a1b2c", monitorIdentity(unnamed))
+
+	assert.Empty(t, monitorIdentity(ddapi.Monitor{Tags: []string{"astro", "astro:uid:0a1b2c"}}))
+}
+
+func TestGetMonitorsPage(t *testing.T) {
+	fake, client := newFakeDatadog(t)
+	for i := 1; i <= 3; i++ {
+		fake.monitors = append(fake.monitors, ddapi.Monitor{Id: ddapi.Int(i)})
+	}
+
+	monitors, err := client.GetMonitorsPage(context.TODO(), []string{"astro"}, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []ddapi.Monitor{{Id: ddapi.Int(3)}}, monitors)
+	assert.Equal(t, 1, fake.count("GET /api/v1/monitor"))
+
+	client.SetKeys("other", "app-key")
+	_, err = client.GetMonitorsPage(context.TODO(), []string{"astro"}, 0, 2)
+	assert.Error(t, err)
+}
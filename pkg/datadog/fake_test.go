@@ -0,0 +1,104 @@
+package datadog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	ddapi "github.com/zorkian/go-datadog-api"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+// fakeDatadog is a minimal in-memory implementation of the Datadog synthetics API, and of listing monitors.
+type fakeDatadog struct {
+	mux      sync.Mutex
+	nextID   int
+	tests    map[string]ddapi.SyntheticsTest
+	monitors []ddapi.Monitor
+	requests []string
+}
+
+func newFakeDatadog(t *testing.T) (*fakeDatadog, *client) {
+	fake := &fakeDatadog{tests: make(map[string]ddapi.SyntheticsTest)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := newClient(&config.Config{DatadogAPIKey: "api-key", DatadogAppKey: "app-key", DatadogAPIURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, client
+}
+
+func (fake *fakeDatadog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mux.Lock()
+	defer fake.mux.Unlock()
+	fake.requests = append(fake.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/monitor":
+		if r.Header.Get("DD-API-KEY") != "api-key" || r.Header.Get("DD-APPLICATION-KEY") != "app-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		monitors := []ddapi.Monitor{}
+		for i := page * pageSize; i < (page+1)*pageSize && i < len(fake.monitors); i++ {
+			monitors = append(monitors, fake.monitors[i])
+		}
+		json.NewEncoder(w).Encode(monitors)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/synthetics/tests":
+		var tests []ddapi.SyntheticsTest
+		for _, test := range fake.tests {
+			tests = append(tests, test)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tests": tests})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/synthetics/tests":
+		var test ddapi.SyntheticsTest
+		json.NewDecoder(r.Body).Decode(&test)
+		fake.nextID++
+		test.SetPublicId(fmt.Sprintf("abc-%d", fake.nextID))
+		test.SetStatus("live")
+		fake.tests[test.GetPublicId()] = test
+		json.NewEncoder(w).Encode(test)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/synthetics/tests/delete":
+		var payload ddapi.DeleteSyntheticsTestsPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		for _, id := range payload.PublicIds {
+			delete(fake.tests, id)
+		}
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/v1/synthetics/tests/"):
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1/synthetics/tests/")
+		if _, found := fake.tests[id]; !found {
+			http.NotFound(w, r)
+			return
+		}
+		var test ddapi.SyntheticsTest
+		json.NewDecoder(r.Body).Decode(&test)
+		fake.tests[id] = test
+		json.NewEncoder(w).Encode(test)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// count returns the number of requests made with the method and path.
+func (fake *fakeDatadog) count(request string) int {
+	fake.mux.Lock()
+	defer fake.mux.Unlock()
+	var count int
+	for _, r := range fake.requests {
+		if r == request {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datadog
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	ddapi "github.com/zorkian/go-datadog-api"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/metrics"
+)
+
+// syntheticsAlertType is the type of the monitors Datadog manages for synthetics tests.
+const syntheticsAlertType = "synthetics alert"
+
+// monitorPageSize is the number of monitors requested in each page when listing the monitors managed by astro.
+const monitorPageSize = 1000
+
+// provisionedMonitors returns the monitors managed by astro from the index, ordered by id.  The monitors are listed
+// from Datadog when the index is empty or older than the refresh interval, so changes made outside of astro are
+// eventually seen.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) provisionedMonitors(ctx context.Context) ([]ddapi.Monitor, error) {
+	refresh := time.Duration(config.GetInstance().MonitorRefreshInterval) * time.Minute
+	if ddman.monitors == nil || time.Since(ddman.listed) >= refresh {
+		if err := ddman.listMonitors(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	monitors := make([]ddapi.Monitor, 0, len(ddman.monitors))
+	for _, monitor := range ddman.monitors {
+		monitors = append(monitors, monitor)
+	}
+	sort.Slice(monitors, func(i, j int) bool { return *monitors[i].Id < *monitors[j].Id })
+	return monitors, nil
+}
+
+// taggedMonitors returns the monitors from the index that have all of the tags specified.  The caller must hold
+// ddman.mux.
+func (ddman *DDMonitorManager) taggedMonitors(ctx context.Context, tags []string) ([]ddapi.Monitor, error) {
+	monitors, err := ddman.provisionedMonitors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tagged []ddapi.Monitor
+	for _, monitor := range monitors {
+		if hasAllTags(monitor.Tags, tags) {
+			tagged = append(tagged, monitor)
+		}
+	}
+	return tagged, nil
+}
+
+// listMonitors replaces the index with every monitor carrying the owner tag, listed a page at a time.  The caller must
+// hold ddman.mux.
+func (ddman *DDMonitorManager) listMonitors(ctx context.Context) error {
+	owner := []string{config.GetInstance().OwnerTag}
+	monitors := make(map[int]ddapi.Monitor)
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	for page := 0; ; page++ {
+		list, err := ddman.Datadog.GetMonitorsPage(ctx, owner, page, monitorPageSize)
+		if err != nil {
+			metrics.DatadogErrCounter.Inc()
+			return err
+		}
+		for _, monitor := range list {
+			if monitor.GetType() == syntheticsAlertType {
+				// the monitor Datadog creates for a synthetics test carries the test's tags, but belongs to the test.
+				continue
+			}
+			if monitor.Id != nil {
+				monitors[*monitor.Id] = monitor
+			}
+		}
+		if len(list) < monitorPageSize {
+			break
+		}
+	}
+	log.Debugf("Listed %d monitors.", len(monitors))
+	ddman.monitors = monitors
+	ddman.listed = time.Now()
+	return nil
+}
+
+// indexMonitor adds or replaces a monitor written by astro in the index.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) indexMonitor(monitor ddapi.Monitor) {
+	if ddman.monitors != nil && monitor.Id != nil {
+		ddman.monitors[*monitor.Id] = monitor
+	}
+}
+
+// unindexMonitor removes a monitor deleted by astro from the index.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) unindexMonitor(id int) {
+	delete(ddman.monitors, id)
+}
+
+// invalidateIndex lists the monitors again on the next reconcile, after a write failed and the index may no longer
+// match Datadog.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) invalidateIndex() {
+	ddman.monitors = nil
+}
+
+// hasAllTags returns whether the tags of a monitor or synthetics test include every tag specified.  Datadog stores tags
+// in lower case, so they are compared without case.
+func hasAllTags(collection []string, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, item := range collection {
+			if strings.EqualFold(item, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datadog
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/fairwindsops/astro/pkg/metrics"
+)
+
+const (
+	maxRetries    = 5                      // The number of times a request is retried after a 429 or 5xx response.
+	retryBaseWait = 500 * time.Millisecond // The wait before the first retry, which doubles with each retry.
+	retryMaxWait  = 30 * time.Second       // The longest wait between retries, unless Datadog asks for a longer one.
+)
+
+// rateLimitTransport throttles every request made to the Datadog API using the rate limit headers of its responses.
+// When a rate limit is used up, or Datadog responds 429, every request waits until the limit resets.  Responses of 429,
+// and 5xx responses to requests that are safe to repeat, are retried with jittered exponential backoff.
+type rateLimitTransport struct {
+	next     http.RoundTripper
+	mux      sync.Mutex
+	resumeAt time.Time // When requests may be sent again after a rate limit was used up
+
+	sleep func(ctx context.Context, wait time.Duration) error // Waits for the duration, or until ctx is done
+}
+
+func newRateLimitTransport(next http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{next: next, sleep: sleep}
+}
+
+// RoundTrip sends a request once no rate limit is used up, retrying it if Datadog is rate limiting or unavailable.
+func (transport *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := transport.waitForLimit(request.Context()); err != nil {
+			return nil, err
+		}
+		if attempt > 0 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request = request.Clone(request.Context())
+			request.Body = body
+		}
+
+		response, err := transport.next.RoundTrip(request)
+		if err != nil {
+			return nil, err
+		}
+		reset := transport.updateLimit(response)
+
+		if attempt >= maxRetries || !retryable(request, response) {
+			return response, nil
+		}
+		wait := backoff(attempt)
+		if response.StatusCode == http.StatusTooManyRequests {
+			transport.pause(reset)
+			if reset > wait {
+				wait = reset
+			}
+		}
+		log.Warnf("Datadog responded %s to %s %s, retrying in %s", response.Status, request.Method, request.URL.Path, wait)
+		metrics.DatadogRetryCounter.Inc()
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		if err := transport.sleep(request.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForLimit waits until requests may be sent again if a rate limit is used up.
+func (transport *rateLimitTransport) waitForLimit(ctx context.Context) error {
+	transport.mux.Lock()
+	wait := time.Until(transport.resumeAt)
+	transport.mux.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	log.Debugf("Datadog rate limit used up, waiting %s", wait)
+	return transport.sleep(ctx, wait)
+}
+
+// updateLimit records the rate limit of a response, pausing every request if it's used up.  It returns the time until
+// the limit resets.
+func (transport *rateLimitTransport) updateLimit(response *http.Response) time.Duration {
+	var reset time.Duration
+	if seconds, err := strconv.Atoi(response.Header.Get("X-RateLimit-Reset")); err == nil {
+		reset = time.Duration(seconds) * time.Second
+	}
+	remaining, err := strconv.Atoi(response.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return reset
+	}
+	name := response.Header.Get("X-RateLimit-Name")
+	if name == "" {
+		name = "unknown"
+	}
+	metrics.DatadogRateLimitRemaining.WithLabelValues(name).Set(float64(remaining))
+	if remaining <= 0 {
+		transport.pause(reset)
+	}
+	return reset
+}
+
+// pause stops every request from being sent for the duration.
+func (transport *rateLimitTransport) pause(wait time.Duration) {
+	transport.mux.Lock()
+	defer transport.mux.Unlock()
+	if resumeAt := time.Now().Add(wait); resumeAt.After(transport.resumeAt) {
+		transport.resumeAt = resumeAt
+	}
+}
+
+// retryable returns whether a request should be sent again after its response.  Requests are always retried when
+// rate limited, but a POST isn't retried after a server error, as it may have created something.  Requests with a body
+// that can't be read again aren't retried.
+func retryable(request *http.Request, response *http.Response) bool {
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+	if response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return response.StatusCode >= 500 && request.Method != http.MethodPost
+}
+
+// backoff returns the wait before a retry, doubling with each attempt and jittered so that callers don't retry
+// together.
+func backoff(attempt int) time.Duration {
+	wait := retryBaseWait << uint(attempt)
+	if wait > retryMaxWait {
+		wait = retryMaxWait
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func sleep(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,165 @@
+package datadog
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fairwindsops/astro/pkg/metrics"
+)
+
+// rateLimitedServer responds with each status in turn, then 200, with the rate limit headers given.
+type rateLimitedServer struct {
+	mux       sync.Mutex
+	statuses  []int
+	headers   map[string]string
+	bodies    []string
+	requested int
+}
+
+func (server *rateLimitedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.Lock()
+	defer server.mux.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	server.bodies = append(server.bodies, string(body))
+	for header, value := range server.headers {
+		w.Header().Set(header, value)
+	}
+	status := http.StatusOK
+	if server.requested < len(server.statuses) {
+		status = server.statuses[server.requested]
+	}
+	server.requested++
+	w.WriteHeader(status)
+	w.Write([]byte("{}"))
+}
+
+// newTestTransport returns a rateLimitTransport that records its waits rather than waiting.
+func newTestTransport(t *testing.T, server *rateLimitedServer) (*http.Client, *[]time.Duration, string) {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	var waits []time.Duration
+	transport := newRateLimitTransport(http.DefaultTransport)
+	transport.sleep = func(ctx context.Context, wait time.Duration) error {
+		waits = append(waits, wait)
+		return ctx.Err()
+	}
+	return &http.Client{Transport: transport}, &waits, httpServer.URL
+}
+
+func TestRateLimitTransportRetriesRateLimited(t *testing.T) {
+	server := &rateLimitedServer{
+		statuses: []int{http.StatusTooManyRequests},
+		headers: map[string]string{
+			"X-RateLimit-Name":      "monitor",
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     "3",
+		},
+	}
+	client, waits, url := newTestTransport(t, server)
+	retries := testutil.ToFloat64(metrics.DatadogRetryCounter)
+
+	// even a POST is retried after a 429, with its body.
+	response, err := client.Post(url+"/api/v1/monitor", "application/json", strings.NewReader(`{"name":"foo"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []string{`{"name":"foo"}`, `{"name":"foo"}`}, server.bodies)
+	assert.Equal(t, retries+1, testutil.ToFloat64(metrics.DatadogRetryCounter))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.DatadogRateLimitRemaining.WithLabelValues("monitor")))
+
+	// the retry waits for the rate limit to reset.
+	assert.NotEmpty(t, *waits)
+	for _, wait := range *waits {
+		assert.True(t, wait > 2*time.Second && wait <= 3*time.Second, "waited %s", wait)
+	}
+}
+
+func TestRateLimitTransportPausesEveryRequest(t *testing.T) {
+	server := &rateLimitedServer{
+		headers: map[string]string{
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     "10",
+		},
+	}
+	client, waits, url := newTestTransport(t, server)
+
+	_, err := client.Get(url + "/api/v1/monitor")
+	assert.NoError(t, err)
+	assert.Empty(t, *waits)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.DatadogRateLimitRemaining.WithLabelValues("unknown")))
+
+	// the limit is used up, so the next request waits until it resets.
+	_, err = client.Get(url + "/api/v1/synthetics/tests")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(*waits))
+	assert.True(t, (*waits)[0] > 9*time.Second, "waited %s", (*waits)[0])
+}
+
+func TestRateLimitTransportRetriesServerErrors(t *testing.T) {
+	server := &rateLimitedServer{statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway}}
+	client, waits, url := newTestTransport(t, server)
+
+	response, err := client.Get(url + "/api/v1/monitor")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 3, server.requested)
+	assert.Equal(t, 2, len(*waits))
+	for attempt, wait := range *waits {
+		limit := retryBaseWait << uint(attempt)
+		assert.True(t, wait >= limit/2 && wait <= limit, "waited %s", wait)
+	}
+
+	// a POST may have created something, so it isn't retried after a server error.
+	server.statuses = []int{0, 0, 0, http.StatusInternalServerError}
+	response, err = client.Post(url+"/api/v1/monitor", "application/json", strings.NewReader("{}"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Equal(t, 4, server.requested)
+
+	// requests are retried a limited number of times.
+	server.statuses = nil
+	for i := 0; i < 10; i++ {
+		server.statuses = append(server.statuses, http.StatusInternalServerError)
+	}
+	server.requested = 0
+	response, err = client.Get(url + "/api/v1/monitor")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Equal(t, maxRetries+1, server.requested)
+}
+
+func TestRateLimitTransportCancelled(t *testing.T) {
+	server := &rateLimitedServer{
+		statuses: []int{http.StatusTooManyRequests},
+		headers:  map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "60"},
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client := &http.Client{Transport: newRateLimitTransport(http.DefaultTransport)}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// waiting for the rate limit to reset stops when the request is cancelled.
+	start := time.Now()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/api/v1/monitor", nil)
+	_, err := client.Do(request)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 10*time.Second)
+	assert.Equal(t, 1, server.requested)
+}
+
+func TestClientThrottled(t *testing.T) {
+	fake, client := newFakeDatadog(t)
+	assert.IsType(t, &rateLimitTransport{}, client.HttpClient.Transport)
+	_, err := client.GetMonitorsPage(context.TODO(), []string{"astro"}, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.count("GET /api/v1/monitor"))
+}
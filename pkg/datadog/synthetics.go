@@ -0,0 +1,213 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datadog
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/imdario/mergo"
+	log "github.com/sirupsen/logrus"
+	ddapi "github.com/zorkian/go-datadog-api"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/metrics"
+)
+
+// AddOrUpdateSyntheticsTest will create a synthetics test if it doesn't exist or update one if it does.
+// Tests are identified amongst provisioned, the tests GetProvisionedSyntheticsTests returned for the object, so the
+// tests are only listed once for every test of an object.
+func (ddman *DDMonitorManager) AddOrUpdateSyntheticsTest(ctx context.Context, test *ddapi.SyntheticsTest, provisioned []ddapi.SyntheticsTest) (*ddapi.SyntheticsTest, error) {
+	log.Debugf("Update templated synthetics test: %v", *test.Name)
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+
+	ddTest := findSyntheticsTest(provisioned, *test)
+	if ddTest == nil {
+		// test doesn't exist
+		log.Infof("Creating new synthetics test: %v", *test.Name)
+		callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+		created, err := ddman.Datadog.CreateSyntheticsTest(callCtx, test)
+		cancel()
+		if err != nil {
+			metrics.DatadogErrCounter.Inc()
+			log.Errorf("Error creating synthetics test %s: %s", *test.Name, err)
+			return nil, err
+		}
+		return created, nil
+	}
+
+	merged, err := mergeSyntheticsTests(*test, *ddTest)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(*merged, *ddTest) {
+		log.Debugf("Synthetics test exists and is up to date: %v", *ddTest.Name)
+		return ddTest, nil
+	}
+
+	log.Infof("Synthetics test updating: %v", *ddTest.Name)
+	callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	updated, err := ddman.Datadog.UpdateSyntheticsTest(callCtx, *ddTest.PublicId, merged)
+	if err != nil {
+		metrics.DatadogErrCounter.Inc()
+		log.Errorf("Could not update synthetics test: %v, error: %s", *ddTest.Name, err)
+		return ddTest, err
+	}
+	return updated, nil
+}
+
+// GetProvisionedSyntheticsTests returns the synthetics tests that carry all of the specified tags.
+func (ddman *DDMonitorManager) GetProvisionedSyntheticsTests(ctx context.Context, tags []string) ([]ddapi.SyntheticsTest, error) {
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+	return ddman.getProvisionedSyntheticsTests(ctx, tags)
+}
+
+// getProvisionedSyntheticsTests lists the synthetics tests that carry all of the specified tags.  The caller must hold
+// ddman.mux.
+func (ddman *DDMonitorManager) getProvisionedSyntheticsTests(ctx context.Context, tags []string) ([]ddapi.SyntheticsTest, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	tests, err := ddman.Datadog.GetSyntheticsTests(ctx)
+	if err != nil {
+		metrics.DatadogErrCounter.Inc()
+		return nil, err
+	}
+
+	var tagged []ddapi.SyntheticsTest
+	for _, test := range tests {
+		if hasAllTags(test.Tags, tags) {
+			tagged = append(tagged, test)
+		}
+	}
+	return tagged, nil
+}
+
+// findSyntheticsTest returns the test in tests that is the desired test, or nil.
+func findSyntheticsTest(tests []ddapi.SyntheticsTest, desired ddapi.SyntheticsTest) *ddapi.SyntheticsTest {
+	for i := range tests {
+		if sameSyntheticsTest(tests[i], desired) {
+			return &tests[i]
+		}
+	}
+	return nil
+}
+
+// syntheticsIdentity returns the identity tags of a synthetics test, in lower case and sorted, or "" if it wasn't
+// tagged with its key in its ruleset.  Tests created by older versions of astro aren't tagged.
+func syntheticsIdentity(test ddapi.SyntheticsTest) string {
+	var identity []string
+	var tagged bool
+	for _, tag := range test.Tags {
+		tag = strings.ToLower(tag)
+		for _, prefix := range config.SyntheticsIdentityTagPrefixes {
+			if strings.HasPrefix(tag, prefix) {
+				identity = append(identity, tag)
+				break
+			}
+		}
+		tagged = tagged || strings.HasPrefix(tag, config.SyntheticsTagPrefix)
+	}
+	if !tagged {
+		return ""
+	}
+	sort.Strings(identity)
+	return strings.Join(identity, ",")
+}
+
+// sameSyntheticsTest returns whether a test in Datadog is the desired test.  Tests are matched by identity, so tests
+// with the same name for different hosts, paths or rulesets are kept apart, or by name if either test isn't tagged
+// with its identity.
+func sameSyntheticsTest(existing ddapi.SyntheticsTest, desired ddapi.SyntheticsTest) bool {
+	existingIdentity, desiredIdentity := syntheticsIdentity(existing), syntheticsIdentity(desired)
+	if existingIdentity != "" && desiredIdentity != "" {
+		return existingIdentity == desiredIdentity
+	}
+	return existing.Name != nil && desired.Name != nil && *existing.Name == *desired.Name
+}
+
+// DeleteSyntheticsTests deletes synthetics tests containing the specified tags.
+func (ddman *DDMonitorManager) DeleteSyntheticsTests(ctx context.Context, tags []string) error {
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+
+	tests, err := ddman.getProvisionedSyntheticsTests(ctx, tags)
+	if err != nil {
+		return err
+	}
+	return ddman.deleteSyntheticsTests(ctx, tests)
+}
+
+// DeleteExtinctSyntheticsTests deletes the tests in provisioned, the tests GetProvisionedSyntheticsTests returned for
+// an object, that aren't one of the desired tests.
+func (ddman *DDMonitorManager) DeleteExtinctSyntheticsTests(ctx context.Context, desired []ddapi.SyntheticsTest, provisioned []ddapi.SyntheticsTest) error {
+	ddman.mux.Lock()
+	defer ddman.mux.Unlock()
+
+	var extinct []ddapi.SyntheticsTest
+	for _, test := range provisioned {
+		if findSyntheticsTest(desired, test) == nil {
+			extinct = append(extinct, test)
+		}
+	}
+	return ddman.deleteSyntheticsTests(ctx, extinct)
+}
+
+// deleteSyntheticsTests deletes tests.  The caller must hold ddman.mux.
+func (ddman *DDMonitorManager) deleteSyntheticsTests(ctx context.Context, tests []ddapi.SyntheticsTest) error {
+	if len(tests) == 0 {
+		return nil
+	}
+
+	var publicIds []string
+	for _, test := range tests {
+		log.Infof("Removing synthetics test: %v", *test.Name)
+		publicIds = append(publicIds, *test.PublicId)
+	}
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	err := ddman.Datadog.DeleteSyntheticsTests(ctx, publicIds)
+	if err != nil {
+		metrics.DatadogErrCounter.Inc()
+		log.Warnf("Error deleting synthetics tests %v: %v", publicIds, err)
+	}
+	return err
+}
+
+// mergeSyntheticsTests fills in the fields of our proposed test that are managed by the DD API
+func mergeSyntheticsTests(newTest, baseTest ddapi.SyntheticsTest) (*ddapi.SyntheticsTest, error) {
+	if newTest.Options != nil && baseTest.Options != nil {
+		options := *newTest.Options
+		err := mergo.Merge(&options, baseTest.Options)
+		if err != nil {
+			return &ddapi.SyntheticsTest{}, err
+		}
+		newTest.Options = &options
+	}
+	newTest.PublicId = baseTest.PublicId
+	newTest.MonitorId = baseTest.MonitorId
+	newTest.CreatedAt = baseTest.CreatedAt
+	newTest.ModifiedAt = baseTest.ModifiedAt
+	newTest.DeletedAt = baseTest.DeletedAt
+	newTest.CreatedBy = baseTest.CreatedBy
+	newTest.ModifiedBy = baseTest.ModifiedBy
+	newTest.Status = baseTest.Status
+	newTest.MonitorStatus = baseTest.MonitorStatus
+	return &newTest, nil
+}
@@ -0,0 +1,106 @@
+package datadog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+)
+
+func newSyntheticsTest(name string, message string, tags []string) *ddapi.SyntheticsTest {
+	test := &ddapi.SyntheticsTest{
+		Name:      &name,
+		Message:   &message,
+		Tags:      tags,
+		Locations: []string{"aws:us-east-2"},
+		Config: &ddapi.SyntheticsConfig{
+			Request: &ddapi.SyntheticsRequest{
+				Url:    ddapi.String("https://example.com/"),
+				Method: ddapi.String("GET"),
+			},
+		},
+	}
+	test.SetType("api")
+	test.SetSubtype("http")
+	return test
+}
+
+func TestSyntheticsLifecycle(t *testing.T) {
+	fake, client := newFakeDatadog(t)
+	ddman := &DDMonitorManager{Datadog: client}
+	tags := []string{"astro", "astro:object_type:ingress", "astro:resource:foo/web"}
+
+	// create
+	_, err := ddman.AddOrUpdateSyntheticsTest(context.TODO(), newSyntheticsTest("web /", "down", tags), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.count("POST /api/v1/synthetics/tests"))
+
+	// unchanged tests are not updated
+	provisioned, err := ddman.GetProvisionedSyntheticsTests(context.TODO(), tags)
+	assert.NoError(t, err)
+	assert.Len(t, provisioned, 1)
+	_, err = ddman.AddOrUpdateSyntheticsTest(context.TODO(), newSyntheticsTest("web /", "down", tags), provisioned)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.count("POST /api/v1/synthetics/tests"))
+	assert.Equal(t, 0, fake.count("PUT /api/v1/synthetics/tests/abc-1"))
+
+	// update
+	_, err = ddman.AddOrUpdateSyntheticsTest(context.TODO(), newSyntheticsTest("web /", "web is down", tags), provisioned)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.count("PUT /api/v1/synthetics/tests/abc-1"))
+	assert.Equal(t, "web is down", *fake.tests["abc-1"].Message)
+
+	// tests owned by other resources are left alone
+	otherTags := []string{"astro", "astro:object_type:ingress", "astro:resource:foo/api"}
+	_, err = ddman.AddOrUpdateSyntheticsTest(context.TODO(), newSyntheticsTest("api /", "down", otherTags), nil)
+	assert.NoError(t, err)
+
+	// tags are compared without case, since Datadog stores them in lower case.
+	provisioned, err = ddman.GetProvisionedSyntheticsTests(context.TODO(), []string{"astro", "astro:object_type:ingress", "astro:resource:foo/Web"})
+	assert.NoError(t, err)
+	assert.Len(t, provisioned, 1)
+
+	// extinct delete
+	err = ddman.DeleteExtinctSyntheticsTests(context.TODO(), nil, provisioned)
+	assert.NoError(t, err)
+	assert.Len(t, fake.tests, 1)
+	assert.Contains(t, fake.tests, "abc-2")
+
+	// delete
+	err = ddman.DeleteSyntheticsTests(context.TODO(), otherTags)
+	assert.NoError(t, err)
+	assert.Len(t, fake.tests, 0)
+}
+
+func TestSyntheticsIdentity(t *testing.T) {
+	fake, client := newFakeDatadog(t)
+	ddman := &DDMonitorManager{Datadog: client}
+	tags := []string{"astro", "astro:object_type:ingress", "astro:resource:foo/web"}
+	www := append([]string{"astro:synthetics:up", "astro:host:www.example.com", "astro:path:/"}, tags...)
+	api := append([]string{"astro:synthetics:up", "astro:host:api.example.com", "astro:path:/"}, tags...)
+
+	// tests whose names render the same are kept apart by the host and path they test.
+	_, err := ddman.AddOrUpdateSyntheticsTest(context.TODO(), newSyntheticsTest("web up", "down", www), nil)
+	assert.NoError(t, err)
+	provisioned, err := ddman.GetProvisionedSyntheticsTests(context.TODO(), tags)
+	assert.NoError(t, err)
+	_, err = ddman.AddOrUpdateSyntheticsTest(context.TODO(), newSyntheticsTest("web up", "down", api), provisioned)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fake.count("POST /api/v1/synthetics/tests"))
+
+	// a test is renamed in place.
+	provisioned, err = ddman.GetProvisionedSyntheticsTests(context.TODO(), tags)
+	assert.NoError(t, err)
+	renamed := newSyntheticsTest("www up", "down", www)
+	_, err = ddman.AddOrUpdateSyntheticsTest(context.TODO(), renamed, provisioned)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fake.count("POST /api/v1/synthetics/tests"))
+	assert.Equal(t, "www up", *fake.tests["abc-1"].Name)
+
+	// only the test for the host that is no longer served is extinct.
+	err = ddman.DeleteExtinctSyntheticsTests(context.TODO(), []ddapi.SyntheticsTest{*renamed}, provisioned)
+	assert.NoError(t, err)
+	assert.Len(t, fake.tests, 1)
+	assert.Contains(t, fake.tests, "abc-1")
+}
@@ -20,6 +20,9 @@ func GetMock(ctrl *gomock.Controller) *mocks.MockClientAPI {
 	ddMon := GetInstance()
 	ddMock := mocks.NewMockClientAPI(ctrl)
 	ddMon.Datadog = ddMock
+	// each test starts without any monitors indexed, so they are listed from the mock.
+	ddMon.monitors = nil
+	ddMon.applied = nil
 
 	return ddMock
 }
@@ -0,0 +1,124 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/kube"
+	"github.com/fairwindsops/astro/pkg/metrics"
+)
+
+// OnAstroMonitorSetChanged is a handler that should be called when an AstroMonitorSet changes.  The ruleset in its
+// spec is merged into the configured rulesets, scoped to the namespace of the AstroMonitorSet, and the result of
+// validating it is written to its status.
+func OnAstroMonitorSetChanged(ctx context.Context, obj *unstructured.Unstructured, event config.Event) {
+	cfg := config.GetInstance()
+
+	switch strings.ToLower(event.EventType) {
+	case "delete":
+		log.Infof("Removing ruleset of AstroMonitorSet %s", event.Key)
+		metrics.ChangeCounter.WithLabelValues("astromonitorsets", "delete").Inc()
+		cfg.DeleteMonitorSet(event.Key)
+	case "create", "update":
+		mSet, errs := parseAstroMonitorSet(obj)
+		if len(errs) > 0 {
+			log.Errorf("AstroMonitorSet %s is invalid: %v", event.Key, errs)
+			cfg.DeleteMonitorSet(event.Key)
+		} else {
+			log.Infof("Loading ruleset of AstroMonitorSet %s", event.Key)
+			cfg.SetMonitorSet(event.Key, mSet)
+		}
+		metrics.ChangeCounter.WithLabelValues("astromonitorsets", "create_update").Inc()
+		updateAstroMonitorSetStatus(ctx, obj, mSet, errs)
+	default:
+		log.Warnf("Update type %s is not valid, skipping.", event.EventType)
+	}
+}
+
+// parseAstroMonitorSet returns the ruleset in the spec of an AstroMonitorSet, and any reasons it is invalid.
+func parseAstroMonitorSet(obj *unstructured.Unstructured) (config.MonitorSet, []error) {
+	var mSet config.MonitorSet
+	spec, found, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil || !found {
+		return mSet, []error{fmt.Errorf("spec is missing or invalid: %v", err)}
+	}
+	data, err := json.Marshal(spec)
+	if err == nil {
+		err = json.Unmarshal(data, &mSet)
+	}
+	if err != nil {
+		return config.MonitorSet{}, []error{fmt.Errorf("spec is not a valid ruleset: %v", err)}
+	}
+	mSet.Namespace = obj.GetNamespace()
+	if errs := mSet.ValidateCustom(config.GetInstance().CustomObjectTypes, isNamespaced); len(errs) > 0 {
+		return config.MonitorSet{}, errs
+	}
+	return mSet, nil
+}
+
+// isNamespaced returns whether objects of the kind specified are namespaced.
+func isNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	mapping, err := kube.GetInstance().RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// updateAstroMonitorSetStatus writes the number of monitors and synthetics tests defined in the ruleset of an
+// AstroMonitorSet, and any validation errors, to its status subresource.  These are the definitions each matching object
+// is given, not the number of monitors in Datadog.
+func updateAstroMonitorSetStatus(ctx context.Context, obj *unstructured.Unstructured, mSet config.MonitorSet, errs []error) {
+	kubeClient := kube.GetInstance()
+	gvk, _ := config.ParseObjectType(config.AstroMonitorSetObjectType)
+	mapping, err := kubeClient.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		log.Errorf("Error finding the AstroMonitorSet resource: %v", err)
+		return
+	}
+
+	validationErrors := make([]interface{}, 0, len(errs))
+	for _, e := range errs {
+		validationErrors = append(validationErrors, e.Error())
+	}
+	status := map[string]interface{}{
+		"observedGeneration": obj.GetGeneration(),
+		"definedMonitors":    int64(len(mSet.Monitors)),
+		"definedSynthetics":  int64(len(mSet.Synthetics)),
+		"validationErrors":   validationErrors,
+	}
+
+	updated := obj.DeepCopy()
+	if err := unstructured.SetNestedField(updated.Object, status, "status"); err != nil {
+		log.Errorf("Error setting status of AstroMonitorSet %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+		return
+	}
+	_, err = kubeClient.DynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()).UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		metrics.ErrorCounter.Inc()
+		log.Errorf("Error updating status of AstroMonitorSet %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+var astroMonitorSetGVR = schema.GroupVersionResource{Group: "astro.fairwinds.com", Version: "v1alpha1", Resource: "astromonitorsets"}
+
+func setAstroMonitorSetMock(objects ...runtime.Object) *kube.ClientInstance {
+	kubeClient := kube.SetAndGetMock()
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "astro.fairwinds.com", Version: "v1alpha1", Kind: "AstroMonitorSet"}, meta.RESTScopeNamespace)
+	kubeClient.RESTMapper = &kube.MockRESTMapper{DefaultRESTMapper: restMapper}
+	kubeClient.DynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	kube.SetInstance(*kubeClient)
+	return kubeClient
+}
+
+func newAstroMonitorSet(spec map[string]interface{}) *unstructured.Unstructured {
+	ams := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	ams.SetAPIVersion("astro.fairwinds.com/v1alpha1")
+	ams.SetKind("AstroMonitorSet")
+	ams.SetNamespace("team")
+	ams.SetName("alerts")
+	ams.SetGeneration(1)
+	return ams
+}
+
+func TestAstroMonitorSetChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ams := newAstroMonitorSet(map[string]interface{}{
+		"type": "deployment",
+		"match_annotations": []interface{}{
+			map[string]interface{}{"name": "team/alerts", "value": "true"},
+		},
+		"monitors": map[string]interface{}{
+			"team-alert": map[string]interface{}{
+				"name":  "Team Alert - {{ .ObjectMeta.Name }}",
+				"type":  "metric alert",
+				"query": "max(last_10m):max:kubernetes_state.deployment.replicas_available{namespace:{{ .ObjectMeta.Namespace }}} <= 0",
+			},
+		},
+	})
+	kubeClient := setAstroMonitorSetMock(ams)
+	event := config.Event{
+		EventType:    "create",
+		Key:          "team/alerts",
+		Namespace:    "team",
+		ResourceType: "astromonitorset",
+	}
+	cfg := config.GetInstance()
+	annotations := map[string]string{"team/alerts": "true"}
+	team := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}}
+	overrides := make(map[string][]config.Override)
+
+	OnAstroMonitorSetChanged(context.TODO(), ams, event)
+	defer cfg.DeleteMonitorSet("team/alerts")
+
+	monitors := *cfg.Rulesets().GetMatchingMonitors(annotations, nil, team, "deployment", overrides)
+	assert.Equal(t, 1, len(monitors))
+	assert.Equal(t, "Team Alert - {{ .ObjectMeta.Name }}", *monitors[0].Name)
+	assert.Empty(t, *cfg.Rulesets().GetMatchingMonitors(annotations, nil, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}}, "deployment", overrides))
+
+	updated, err := kubeClient.DynamicClient.Resource(astroMonitorSetGVR).Namespace("team").Get(context.TODO(), "alerts", metav1.GetOptions{})
+	assert.NoError(t, err)
+	count, _, _ := unstructured.NestedInt64(updated.Object, "status", "definedMonitors")
+	assert.Equal(t, int64(1), count)
+	synthetics, found, _ := unstructured.NestedInt64(updated.Object, "status", "definedSynthetics")
+	assert.True(t, found)
+	assert.Equal(t, int64(0), synthetics)
+	errs, _, _ := unstructured.NestedStringSlice(updated.Object, "status", "validationErrors")
+	assert.Empty(t, errs)
+
+	event.EventType = "delete"
+	OnAstroMonitorSetChanged(context.TODO(), &unstructured.Unstructured{}, event)
+	assert.Empty(t, *cfg.Rulesets().GetMatchingMonitors(annotations, nil, team, "deployment", overrides))
+}
+
+func TestAstroMonitorSetInvalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ams := newAstroMonitorSet(map[string]interface{}{
+		"type": "static",
+	})
+	kubeClient := setAstroMonitorSetMock(ams)
+	event := config.Event{
+		EventType:    "create",
+		Key:          "team/alerts",
+		Namespace:    "team",
+		ResourceType: "astromonitorset",
+	}
+
+	OnAstroMonitorSetChanged(context.TODO(), ams, event)
+	defer config.GetInstance().DeleteMonitorSet("team/alerts")
+
+	updated, err := kubeClient.DynamicClient.Resource(astroMonitorSetGVR).Namespace("team").Get(context.TODO(), "alerts", metav1.GetOptions{})
+	assert.NoError(t, err)
+	count, _, _ := unstructured.NestedInt64(updated.Object, "status", "definedMonitors")
+	assert.Equal(t, int64(0), count)
+	errs, _, _ := unstructured.NestedStringSlice(updated.Object, "status", "validationErrors")
+	assert.Equal(t, []string{"type static can't be used in an AstroMonitorSet", "no monitors are defined"}, errs)
+}
+
+func TestAstroMonitorSetObjectTypes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	cfg := config.GetInstance()
+	defer func(objectTypes []string) { cfg.CustomObjectTypes = objectTypes }(cfg.CustomObjectTypes)
+	cfg.CustomObjectTypes = []string{"argoproj.io/v1alpha1/Rollout", "v1/PersistentVolume"}
+
+	ams := newAstroMonitorSet(map[string]interface{}{
+		"type":          "binding",
+		"bound_objects": []interface{}{"argoproj.io/v1alpha1/Rollout", "v1/PersistentVolume", "example.com/v1/Widget"},
+		"match_all":     true,
+		"monitors":      map[string]interface{}{"team-alert": map[string]interface{}{"name": "Team Alert"}},
+	})
+	kubeClient := setAstroMonitorSetMock(ams)
+	restMapper := kubeClient.RESTMapper.(*kube.MockRESTMapper)
+	restMapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolume"}, meta.RESTScopeRoot)
+	event := config.Event{
+		EventType:    "create",
+		Key:          "team/alerts",
+		Namespace:    "team",
+		ResourceType: "astromonitorset",
+	}
+
+	OnAstroMonitorSetChanged(context.TODO(), ams, event)
+	defer cfg.DeleteMonitorSet("team/alerts")
+
+	updated, err := kubeClient.DynamicClient.Resource(astroMonitorSetGVR).Namespace("team").Get(context.TODO(), "alerts", metav1.GetOptions{})
+	assert.NoError(t, err)
+	errs, _, _ := unstructured.NestedStringSlice(updated.Object, "status", "validationErrors")
+	assert.Equal(t, []string{
+		"type v1/PersistentVolume is cluster scoped, so it can't be used in an AstroMonitorSet",
+		"type example.com/v1/Widget is not allowed in an AstroMonitorSet",
+	}, errs)
+}
@@ -20,35 +20,120 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/fairwindsops/astro/pkg/config"
 	"github.com/fairwindsops/astro/pkg/kube"
 )
 
-func updateBoundResources(namespace *corev1.Namespace, kc *kube.ClientInstance) {
-	deploys, err := kc.Client.AppsV1().Deployments(namespace.Name).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Errorf("Error getting bound deployments for namespace %q.", namespace.Name)
-		return
+type boundObjectLister func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error)
+
+// boundObjectListers list the objects of each type in config.BindableObjectTypes in a namespace.
+var boundObjectListers = map[string]boundObjectLister{
+	"deployment": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"statefulset": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"daemonset": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"cronjob": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.BatchV1beta1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"job": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"service": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"horizontalpodautoscaler": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"persistentvolumeclaim": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	},
+	"ingress": func(ctx context.Context, kc *kube.ClientInstance, namespace string) (runtime.Object, error) {
+		return kc.Client.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	},
+}
+
+// updateBoundResources reconciles every object in a namespace whose rulesets depend on the namespace, such as
+// objects whose type is bound by a binding ruleset.  All bound types are reconciled, not just those bound to the
+// namespace, so monitors are also removed from objects when a namespace stops matching a binding.
+func updateBoundResources(ctx context.Context, namespace *corev1.Namespace, kc *kube.ClientInstance) {
+	for _, objectType := range config.GetInstance().Rulesets().GetNamespaceDependentObjectTypes() {
+		list, err := listBoundObjects(ctx, kc, objectType, namespace.Name)
+		if err != nil {
+			log.Errorf("Error getting bound %ss for namespace %q: %v", objectType, namespace.Name, err)
+			continue
+		}
+		objects, err := meta.ExtractList(list)
+		if err != nil {
+			log.Errorf("Error reading bound %ss for namespace %q: %v", objectType, namespace.Name, err)
+			continue
+		}
+		for _, obj := range objects {
+			onChanged(ctx, obj, setupBoundEvent(obj))
+		}
+	}
+}
+
+func listBoundObjects(ctx context.Context, kc *kube.ClientInstance, objectType string, namespace string) (runtime.Object, error) {
+	if lister, found := boundObjectListers[objectType]; found {
+		return lister(ctx, kc, namespace)
 	}
-	for _, dep := range deploys.Items {
-		evt := setupBoundEvent(&dep)
-		OnDeploymentChanged(&dep, evt)
+	gvk, ok := config.ParseObjectType(objectType)
+	if !ok {
+		return nil, fmt.Errorf("object type %s is not watched", objectType)
 	}
+	mapping, err := kc.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	return kc.DynamicClient.Resource(mapping.Resource).Namespace(namespace).List(ctx, metav1.ListOptions{})
 }
 
 func setupBoundEvent(obj interface{}) config.Event {
 	var evt config.Event
 	switch object := obj.(type) {
 	case *appsv1.Deployment:
-		evt.Key = fmt.Sprintf("%s/%s", object.Namespace, object.Name)
-		evt.Namespace = object.Namespace
 		evt.ResourceType = "deployment"
+	case *appsv1.StatefulSet:
+		evt.ResourceType = "statefulset"
+	case *appsv1.DaemonSet:
+		evt.ResourceType = "daemonset"
+	case *batchv1beta1.CronJob:
+		evt.ResourceType = "cronjob"
+	case *batchv1.Job:
+		evt.ResourceType = "job"
+	case *corev1.Service:
+		evt.ResourceType = "service"
+	case *autoscalingv1.HorizontalPodAutoscaler:
+		evt.ResourceType = "horizontalpodautoscaler"
+	case *corev1.PersistentVolumeClaim:
+		evt.ResourceType = "persistentvolumeclaim"
+	case *networkingv1.Ingress:
+		evt.ResourceType = "ingress"
+	case *unstructured.Unstructured:
+		// generic object types are written as group/version/kind, which is the apiVersion followed by the kind.
+		evt.ResourceType = fmt.Sprintf("%s/%s", object.GetAPIVersion(), object.GetKind())
 	default:
 		log.Warnf("Object has unknown type of %T", object)
 	}
+	if object, err := meta.Accessor(obj); err == nil {
+		evt.Key = fmt.Sprintf("%s/%s", object.GetNamespace(), object.GetName())
+		evt.Namespace = object.GetNamespace()
+	}
 	evt.EventType = "update"
 	return evt
 }
@@ -9,6 +9,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/fairwindsops/astro/pkg/config"
 	"github.com/fairwindsops/astro/pkg/datadog"
@@ -40,16 +41,12 @@ func TestUpdateBoundResources(t *testing.T) {
 	kubeClient.Client.AppsV1().Deployments(ns.Name).Create(context.TODO(), dep, metav1.CreateOptions{})
 
 	tags := []string{"astro"}
-	depTags := []string{"astro", "astro:object_type:deployment", "astro:resource:bound/foo"}
 	getTagsCall := ddMock.
 		EXPECT().
-		GetMonitorsByMonitorTags(tags)
+		GetMonitorsPage(gomock.Any(), tags, 0, gomock.Any())
 	ddMock.
 		EXPECT().
-		GetMonitorsByMonitorTags(depTags)
-	ddMock.
-		EXPECT().
-		CreateMonitor(gomock.Any()).
+		CreateMonitor(gomock.Any(), gomock.Any()).
 		After(getTagsCall)
 
 	event := config.Event{
@@ -57,7 +54,7 @@ func TestUpdateBoundResources(t *testing.T) {
 		Namespace:    "bound",
 		ResourceType: "namespace",
 	}
-	OnNamespaceChanged(ns, event)
+	OnNamespaceChanged(context.TODO(), ns, event)
 }
 
 func TestSetupBoundEvent(t *testing.T) {
@@ -77,3 +74,103 @@ func TestSetupBoundEvent(t *testing.T) {
 	assert.Equal(t, "deployment", event.ResourceType)
 	assert.Equal(t, "update", event.EventType)
 }
+
+func TestSetupBoundEventStatefulSet(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-sts",
+			Namespace: "foo",
+		},
+	}
+
+	event := setupBoundEvent(sts)
+	assert.Equal(t, "foo/test-sts", event.Key)
+	assert.Equal(t, "foo", event.Namespace)
+	assert.Equal(t, "statefulset", event.ResourceType)
+	assert.Equal(t, "update", event.EventType)
+}
+
+func TestBoundObjectListers(t *testing.T) {
+	for _, objectType := range config.BindableObjectTypes {
+		assert.Contains(t, boundObjectListers, objectType)
+	}
+}
+
+func TestUpdateBoundResourcesStatefulSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "bound",
+			Annotations: map[string]string{"test": "yup"},
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: ns.Name,
+		},
+	}
+	kubeClient.Client.AppsV1().StatefulSets(ns.Name).Create(context.TODO(), sts, metav1.CreateOptions{})
+
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall)
+
+	updateBoundResources(context.TODO(), ns, kubeClient)
+}
+
+func TestSetupBoundEventUnstructured(t *testing.T) {
+	rollout := &unstructured.Unstructured{}
+	rollout.SetAPIVersion("argoproj.io/v1alpha1")
+	rollout.SetKind("Rollout")
+	rollout.SetNamespace("foo")
+	rollout.SetName("test-rollout")
+
+	event := setupBoundEvent(rollout)
+	assert.Equal(t, "foo/test-rollout", event.Key)
+	assert.Equal(t, "foo", event.Namespace)
+	assert.Equal(t, "argoproj.io/v1alpha1/Rollout", event.ResourceType)
+	assert.Equal(t, "update", event.EventType)
+}
+
+func TestUpdateBoundResourcesResync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "bound",
+			Annotations: map[string]string{"test": "yup"},
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.AppsV1().Deployments(ns.Name).Create(context.TODO(), dep, metav1.CreateOptions{})
+
+	// the deployment is resynced by its own watcher, so resyncing the namespace only lists the monitors of the
+	// namespace, to remove any that are extinct, and creates none.
+	ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	event := config.Event{
+		EventType:    "resync",
+		Key:          "bound",
+		ResourceType: "namespace",
+	}
+	OnUpdate(context.TODO(), ns, event)
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+// OnCronJobChanged is a handler that should be called when a cronjob changes.
+func OnCronJobChanged(ctx context.Context, cronJob *batchv1beta1.CronJob, event config.Event) {
+	onObjectChanged(ctx, cronJob, cronJob.Annotations, cronJob.Labels, event, "cronjobs")
+}
+
+// The runs of a schedule are enumerated from scheduleReference, a Monday, for a year or up to scheduleMaxRuns runs,
+// whichever is shorter, so the window of a schedule doesn't depend on when it is computed.  A schedule that runs every
+// minute is enumerated for a week.
+var (
+	scheduleReference = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+	schedulePeriod    = 365 * 24 * time.Hour
+	scheduleMaxRuns   = 7 * 24 * 60
+)
+
+// scheduleWindows caches the window of each schedule, which never changes.
+var scheduleWindows sync.Map
+
+// scheduleWindow returns the longest number of minutes between two consecutive runs of a cron schedule.  Gaps vary for
+// schedules such as 0 9 * * 1-5, so the longest is used, and the window is the same whenever the object is reconciled.
+// It is available to templates so monitors can alert when a cronjob misses its window, eg last_{{ scheduleWindow .Spec.Schedule }}m
+func scheduleWindow(schedule string) (int, error) {
+	schedule = strings.TrimSpace(schedule)
+	if window, found := scheduleWindows.Load(schedule); found {
+		return window.(int), nil
+	}
+	parsed, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule %q: %v", schedule, err)
+	}
+	end := scheduleReference.Add(schedulePeriod)
+	previous := parsed.Next(scheduleReference)
+	var window time.Duration
+	for runs := 1; ; runs++ {
+		next := parsed.Next(previous)
+		if next.IsZero() {
+			return 0, fmt.Errorf("schedule %q doesn't run more than once", schedule)
+		}
+		if gap := next.Sub(previous); gap > window {
+			window = gap
+		}
+		if next.After(end) || runs >= scheduleMaxRuns {
+			break
+		}
+		previous = next
+	}
+	minutes := int(window.Round(time.Minute) / time.Minute)
+	scheduleWindows.Store(schedule, minutes)
+	return minutes, nil
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func TestScheduleWindow(t *testing.T) {
+	window, err := scheduleWindow("*/15 * * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, 15, window)
+
+	window, err = scheduleWindow("@hourly")
+	assert.NoError(t, err)
+	assert.Equal(t, 60, window)
+
+	_, err = scheduleWindow("not a schedule")
+	assert.Error(t, err)
+
+	window, err = scheduleWindow("0 0 1 * *")
+	assert.NoError(t, err)
+	assert.Equal(t, 31*24*60, window)
+
+	// gaps between the runs of irregular schedules vary, so the longest one is used whichever day the runs are
+	// enumerated from.
+	defer func(reference time.Time) { scheduleReference = reference }(scheduleReference)
+	for _, days := range []int{0, 3, 5, 6} {
+		scheduleWindows = sync.Map{}
+		scheduleReference = time.Date(2021, time.March, 1+days, 10, 0, 0, 0, time.UTC)
+		window, err = scheduleWindow("0 9 * * 1-5")
+		assert.NoError(t, err)
+		assert.Equal(t, 72*60, window)
+	}
+}
+
+func TestCronJobChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "backup",
+			Namespace:   "foo",
+			Annotations: map[string]string{"astro/owner": "astro"},
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule: "0 */2 * * *",
+		},
+	}
+	event := config.Event{
+		Key:          "foo/backup",
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "cronjob",
+	}
+
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Contains(t, *monitor.Query, "max(last_120m)")
+			assert.Contains(t, *monitor.Message, "backup (0 */2 * * *)")
+		})
+
+	OnCronJobChanged(context.TODO(), cronJob, event)
+}
+
+func TestJobOwnedByCronJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "backup",
+			Namespace:   "foo",
+			Annotations: map[string]string{"astro/owner": "astro"},
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule: "@daily",
+		},
+	}
+	kubeClient.Client.BatchV1beta1().CronJobs("foo").Create(context.TODO(), cronJob, metav1.CreateOptions{})
+	controller := true
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "backup-1600000000",
+			Namespace:   "foo",
+			Annotations: map[string]string{"astro/owner": "astro"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "CronJob", Name: "backup", Controller: &controller},
+			},
+		},
+	}
+
+	// the job run reconciles the cronjob's monitors rather than creating its own.  A monitor tagged with the job is
+	// listed, to check that deleting the job doesn't delete monitors.
+	jobMonitor := ddapi.Monitor{
+		Id:   ddapi.Int(1),
+		Name: ddapi.String("Job Failed - backup-1600000000"),
+		Tags: []string{"astro", "astro:object_type:job", "astro:resource:foo/backup-1600000000"},
+	}
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any()).
+		Return([]ddapi.Monitor{jobMonitor}, nil)
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Contains(t, monitor.Tags, "astro:object_type:cronjob")
+			assert.Contains(t, monitor.Tags, "astro:resource:foo/backup")
+		})
+
+	OnJobChanged(context.TODO(), job, config.Event{
+		Key:          "foo/backup-1600000000",
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "job",
+	})
+
+	// deleting a finished run leaves the cronjob's monitors alone
+	OnUpdate(context.TODO(), nil, config.Event{
+		Key:          "foo/backup-1600000000",
+		EventType:    "delete",
+		Namespace:    "foo",
+		OldMeta:      &job.ObjectMeta,
+		ResourceType: "job",
+	})
+}
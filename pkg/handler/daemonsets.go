@@ -0,0 +1,28 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+// OnDaemonSetChanged is a handler that should be called when a daemonset changes.
+func OnDaemonSetChanged(ctx context.Context, daemonSet *appsv1.DaemonSet, event config.Event) {
+	onObjectChanged(ctx, daemonSet, daemonSet.Annotations, daemonSet.Labels, event, "daemonsets")
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func TestDaemonSetChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	annotations := make(map[string]string, 1)
+	annotations["astro/owner"] = "astro"
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "fluentd",
+			Namespace:   "foo",
+			Annotations: annotations,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{"cloud.google.com/gke-nodepool": "logging"},
+				},
+			},
+		},
+	}
+	kubeClient.Client.AppsV1().DaemonSets("foo").Create(context.TODO(), ds, metav1.CreateOptions{})
+	event := config.Event{
+		Key:          "foo/fluentd",
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "daemonset",
+	}
+
+	tags := []string{"astro"}
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), tags, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Contains(t, monitor.Tags, "nodepool:logging")
+			assert.Contains(t, monitor.Tags, "astro:object_type:daemonset")
+			assert.Contains(t, monitor.Tags, "astro:resource:foo/fluentd")
+		})
+
+	OnDaemonSetChanged(context.TODO(), ds, event)
+}
+
+func TestDaemonSetDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	event := config.Event{
+		Key:          "foo/fluentd",
+		EventType:    "delete",
+		Namespace:    "foo",
+		ResourceType: "daemonset",
+	}
+
+	id := 1
+	ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any()).
+		Return([]ddapi.Monitor{
+			{Id: &id, Tags: []string{"astro", "astro:object_type:daemonset", "astro:resource:foo/fluentd"}},
+			{Id: ddapi.Int(2), Tags: []string{"astro", "astro:object_type:daemonset", "astro:resource:foo/other"}},
+		}, nil)
+	ddMock.
+		EXPECT().
+		DeleteMonitor(gomock.Any(), id)
+
+	OnUpdate(context.TODO(), nil, event)
+}
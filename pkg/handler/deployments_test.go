@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	ddapi "github.com/zorkian/go-datadog-api"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -45,13 +46,52 @@ func TestDeploymentChange(t *testing.T) {
 	tags := []string{"astro"}
 	getTagsCall := ddMock.
 		EXPECT().
-		GetMonitorsByMonitorTags(tags)
+		GetMonitorsPage(gomock.Any(), tags, 0, gomock.Any())
 	ddMock.
 		EXPECT().
-		CreateMonitor(gomock.Any()).
+		CreateMonitor(gomock.Any(), gomock.Any()).
 		After(getTagsCall)
 
-	OnDeploymentChanged(dep, event)
+	OnDeploymentChanged(context.TODO(), dep, event)
+}
+
+func TestDeploymentChangeCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Annotations: map[string]string{"astro/owner": "astro"},
+		},
+	}
+	event := config.Event{
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "deployment",
+	}
+
+	// requests to Datadog are made with the context of the event, so no monitors are created once it is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, tags []string, page int, pageSize int) ([]ddapi.Monitor, error) {
+			return nil, ctx.Err()
+		}).
+		MinTimes(1)
+
+	OnDeploymentChanged(ctx, dep, event)
 }
 
 func TestDeploymentChangeNoMatch(t *testing.T) {
@@ -83,5 +123,5 @@ func TestDeploymentChangeNoMatch(t *testing.T) {
 
 	// Don't expect any calls to Datadog
 
-	OnDeploymentChanged(dep, event)
+	OnDeploymentChanged(context.TODO(), dep, event)
 }
@@ -16,6 +16,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -25,54 +26,223 @@ import (
 	log "github.com/sirupsen/logrus"
 	ddapi "github.com/zorkian/go-datadog-api"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+	"github.com/fairwindsops/astro/pkg/metrics"
 )
 
 // OnUpdate is a handler that should be called when an object is updated.
 // obj is the Kubernetes object that was updated.
 // event is the Event metadata representing the update.
-func OnUpdate(obj interface{}, event config.Event) {
+// ctx cancels the requests made to reconcile the object, such as when astro shuts down.
+func OnUpdate(ctx context.Context, obj interface{}, event config.Event) {
 	log.Debugf("Handler got an OnUpdate event of type %s", event.ResourceType)
 
 	if event.EventType == "delete" {
-		onDelete(event)
+		onDelete(ctx, event)
+		return
+	}
+
+	if !config.GetInstance().Loaded() && event.ResourceType != "astromonitorset" {
+		// monitors of the rulesets that failed to load would be deleted.  The object is reconciled again when they
+		// are loaded, since that changes the rulesets.
+		log.Debugf("Rulesets haven't been loaded yet, not reconciling %s", event.Key)
+		return
+	}
+
+	if event.EventType == "resync" {
+		// the rulesets have changed, so the object is reconciled with them even though the object itself hasn't.
+		event.EventType = "update"
+		event.Resync = true
+		onChanged(ctx, obj, event)
 		return
 	}
 
 	oldMeta := *event.OldMeta
 	newMeta := *event.NewMeta
 
-	if reflect.DeepEqual(oldMeta.Annotations, newMeta.Annotations) {
-		log.Debugf("Old annotations match new, not updating: %s", event.Key)
+	if event.ResourceType == "astromonitorset" {
+		// rulesets are read from the spec.  Writing the status doesn't change the generation, so it is ignored.
+		if event.EventType == "update" && oldMeta.Generation == newMeta.Generation {
+			log.Debugf("Old generation matches new, not updating: %s", event.Key)
+			return
+		}
+		OnAstroMonitorSetChanged(ctx, obj.(*unstructured.Unstructured), event)
 		return
 	}
 
+	// objects are always reconciled when they are created, since match_all rulesets apply to them regardless of
+	// their annotations and labels.
+	if event.EventType == "update" && reflect.DeepEqual(oldMeta.Annotations, newMeta.Annotations) && reflect.DeepEqual(oldMeta.Labels, newMeta.Labels) {
+		log.Debugf("Old annotations and labels match new, not updating: %s", event.Key)
+		return
+	}
+
+	onChanged(ctx, obj, event)
+}
+
+// onChanged calls the handler for the type of obj.
+func onChanged(ctx context.Context, obj interface{}, event config.Event) {
 	switch t := obj.(type) {
 	case *appsv1.Deployment:
-		OnDeploymentChanged(obj.(*appsv1.Deployment), event)
+		OnDeploymentChanged(ctx, obj.(*appsv1.Deployment), event)
+	case *appsv1.StatefulSet:
+		OnStatefulSetChanged(ctx, obj.(*appsv1.StatefulSet), event)
+	case *appsv1.DaemonSet:
+		OnDaemonSetChanged(ctx, obj.(*appsv1.DaemonSet), event)
+	case *batchv1beta1.CronJob:
+		OnCronJobChanged(ctx, obj.(*batchv1beta1.CronJob), event)
+	case *batchv1.Job:
+		OnJobChanged(ctx, obj.(*batchv1.Job), event)
 	case *corev1.Namespace:
-		OnNamespaceChanged(obj.(*corev1.Namespace), event)
+		OnNamespaceChanged(ctx, obj.(*corev1.Namespace), event)
+	case *corev1.Node:
+		OnNodeChanged(ctx, obj.(*corev1.Node), event)
+	case *corev1.Service:
+		OnServiceChanged(ctx, obj.(*corev1.Service), event)
+	case *autoscalingv1.HorizontalPodAutoscaler:
+		OnHorizontalPodAutoscalerChanged(ctx, obj.(*autoscalingv1.HorizontalPodAutoscaler), event)
+	case *corev1.PersistentVolumeClaim:
+		OnPersistentVolumeClaimChanged(ctx, obj.(*corev1.PersistentVolumeClaim), event)
+	case *networkingv1.Ingress:
+		OnIngressChanged(ctx, obj.(*networkingv1.Ingress), event)
+	case *unstructured.Unstructured:
+		OnUnstructuredChanged(ctx, obj.(*unstructured.Unstructured), event)
 	default:
 		log.Warnf("Object has unknown type of %T", t)
 	}
 }
 
-func onDelete(event config.Event) {
+func onDelete(ctx context.Context, event config.Event) {
 	switch strings.ToLower(event.ResourceType) {
 	case "namespace":
-		OnNamespaceChanged(&corev1.Namespace{}, event)
+		OnNamespaceChanged(ctx, &corev1.Namespace{}, event)
 	case "deployment":
-		OnDeploymentChanged(&appsv1.Deployment{}, event)
+		OnDeploymentChanged(ctx, &appsv1.Deployment{}, event)
+	case "statefulset":
+		OnStatefulSetChanged(ctx, &appsv1.StatefulSet{}, event)
+	case "daemonset":
+		OnDaemonSetChanged(ctx, &appsv1.DaemonSet{}, event)
+	case "cronjob":
+		OnCronJobChanged(ctx, &batchv1beta1.CronJob{}, event)
+	case "job":
+		// whether a deleted job belongs to a cronjob is found from its owner references.
+		OnJobChanged(ctx, &batchv1.Job{ObjectMeta: *event.OldMeta}, event)
+	case "ingress":
+		OnIngressChanged(ctx, &networkingv1.Ingress{}, event)
+	case "service":
+		OnServiceChanged(ctx, &corev1.Service{}, event)
+	case "horizontalpodautoscaler":
+		OnHorizontalPodAutoscalerChanged(ctx, &autoscalingv1.HorizontalPodAutoscaler{}, event)
+	case "persistentvolumeclaim":
+		OnPersistentVolumeClaimChanged(ctx, &corev1.PersistentVolumeClaim{}, event)
+	case "astromonitorset":
+		OnAstroMonitorSetChanged(ctx, &unstructured.Unstructured{}, event)
+	case "node":
+		// the pool of a deleted node is found from its labels.
+		OnNodeChanged(ctx, &corev1.Node{ObjectMeta: *event.OldMeta}, event)
 	default:
+		if _, ok := config.ParseObjectType(event.ResourceType); ok {
+			OnUnstructuredChanged(ctx, &unstructured.Unstructured{}, event)
+			return
+		}
 		log.Warnf("object has unknown resource type %s", event.ResourceType)
 	}
 }
 
-func applyTemplateToField(obj interface{}, tmplString string) (string, error) {
+// onObjectChanged reconciles the monitors for an object.  This includes monitors matching the object itself
+// as well as any bound to it through its namespace, if it has one.
+// metricObject is the object label used when counting changes.
+func onObjectChanged(ctx context.Context, obj interface{}, annotations map[string]string, labels map[string]string, event config.Event, metricObject string) {
+	cfg := config.GetInstance()
+	dd := datadog.GetInstance()
+	overrides := parseOverrides(obj)
+
+	switch strings.ToLower(event.EventType) {
+	case "delete":
+		if cfg.DryRun == false {
+			log.Debug("Deleting resource monitors.")
+			metrics.ChangeCounter.WithLabelValues(metricObject, "delete").Inc()
+			dd.DeleteMonitors(ctx, []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)})
+		}
+	case "create", "update":
+		ns, err := getNamespace(ctx, event.Namespace)
+		if err != nil {
+			log.Errorf("Error getting namespace %s: %+v", event.Namespace, err)
+			return
+		}
+		// both kinds of monitors are found in the same rulesets, even if they are reloaded meanwhile.
+		rulesets := cfg.Rulesets()
+		mSets := rulesets.GetMatchingMonitorSets(annotations, labels, ns, event.ResourceType, overrides)
+
+		if ns != nil {
+			mSets = append(mSets, rulesets.GetBoundMonitorSets(ns, event.ResourceType, overrides)...)
+		}
+		reconcileMonitors(ctx, obj, rulesets, mSets, event, metricObject)
+	default:
+		log.Warnf("Update type %s is not valid, skipping.", event.EventType)
+	}
+}
+
+// getNamespace returns the namespace named, or nil for the empty namespace of cluster scoped objects.
+func getNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return kube.GetInstance().Client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+}
+
+// reconcileMonitors templates the monitors of mSets, found in rulesets, against obj and creates or updates them in
+// Datadog.  On updates, any monitors previously managed for the event's resource that are no longer desired are removed.
+func reconcileMonitors(ctx context.Context, obj interface{}, rulesets *config.Ruleset, mSets []config.MonitorSet, event config.Event, metricObject string) {
+	var record []ddapi.Monitor
+	cfg := config.GetInstance()
+	dd := datadog.GetInstance()
+
+	for _, mSet := range mSets {
+		funcs := ancillaryVariables(rulesets, mSet.Namespace)
+		for _, monitor := range mSet.Monitors {
+			err := applyTemplate(obj, &monitor, &event, funcs)
+			if err != nil {
+				metrics.TemplateErrorCounter.Inc()
+				log.Errorf("Error applying template for monitor %s: %v", *monitor.Name, err)
+				return
+			}
+			log.Debugf("Reconcile monitor %s", *monitor.Name)
+			if cfg.DryRun == false {
+				_, err := dd.AddOrUpdate(ctx, &monitor)
+				metrics.ChangeCounter.WithLabelValues(metricObject, "create_update").Inc()
+				record = append(record, monitor)
+				if err != nil {
+					metrics.ErrorCounter.Inc()
+					log.Errorf("Error adding/updating monitor")
+				}
+			} else {
+				log.Info("Running as DryRun, skipping DataDog update")
+			}
+		}
+	}
+
+	if strings.ToLower(event.EventType) == "update" && !cfg.DryRun {
+		// if there are any additional monitors, they should be removed.  This could happen if an object
+		// was previously monitored and now no longer is.
+		datadog.DeleteExtinctMonitors(ctx, record, []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)})
+	}
+}
+
+func applyTemplateToField(obj interface{}, tmplString string, funcs map[string]interface{}) (string, error) {
 	var buf bytes.Buffer
-	tpl, err := template.New("").Funcs(ancillaryVariables()).Parse(tmplString)
+	tpl, err := template.New("").Funcs(funcs).Parse(tmplString)
 	if err != nil {
 		return "", err
 	}
@@ -83,10 +253,27 @@ func applyTemplateToField(obj interface{}, tmplString string) (string, error) {
 	return buf.String(), nil
 }
 
-func applyTemplate(obj interface{}, monitor *ddapi.Monitor, event *config.Event) error {
+// ValidateTemplate checks that a monitor template parses with the functions that are available when it is applied.
+func ValidateTemplate(tmplString string) error {
+	_, err := template.New("").Funcs(ancillaryVariables(&config.Ruleset{}, "")).Parse(tmplString)
+	return err
+}
+
+// applyTemplate templates the fields of monitor against obj with funcs, and tags it with the identity of the event's
+// resource.
+func applyTemplate(obj interface{}, monitor *ddapi.Monitor, event *config.Event, funcs map[string]interface{}) error {
+	// the monitor is identified by the UID of its object, so it's found again if its name template changes.
+	var uid string
+	if object, err := meta.Accessor(obj); err == nil {
+		uid = string(object.GetUID())
+	}
+	if object, ok := obj.(*unstructured.Unstructured); ok {
+		// objects watched through the dynamic client are templated against their content, eg {{ .metadata.name }}
+		obj = object.Object
+	}
 	if event.ResourceType != "static" {
 		if monitor.Name != nil {
-			name, err := applyTemplateToField(obj, *monitor.Name)
+			name, err := applyTemplateToField(obj, *monitor.Name, funcs)
 			if err != nil {
 				return err
 			}
@@ -94,7 +281,7 @@ func applyTemplate(obj interface{}, monitor *ddapi.Monitor, event *config.Event)
 		}
 
 		if monitor.Query != nil {
-			query, err := applyTemplateToField(obj, *monitor.Query)
+			query, err := applyTemplateToField(obj, *monitor.Query, funcs)
 			if err != nil {
 				return err
 			}
@@ -102,7 +289,7 @@ func applyTemplate(obj interface{}, monitor *ddapi.Monitor, event *config.Event)
 		}
 
 		if monitor.Message != nil {
-			message, err := applyTemplateToField(obj, *monitor.Message)
+			message, err := applyTemplateToField(obj, *monitor.Message, funcs)
 			if err != nil {
 				return err
 			}
@@ -112,7 +299,7 @@ func applyTemplate(obj interface{}, monitor *ddapi.Monitor, event *config.Event)
 		if monitor.Tags != nil {
 			tags := []string{}
 			for _, tag := range monitor.Tags {
-				tag, err := applyTemplateToField(obj, tag)
+				tag, err := applyTemplateToField(obj, tag, funcs)
 				if err != nil {
 					return err
 				}
@@ -122,7 +309,7 @@ func applyTemplate(obj interface{}, monitor *ddapi.Monitor, event *config.Event)
 		}
 
 		if monitor.Options != nil && monitor.Options.EscalationMessage != nil {
-			message, err := applyTemplateToField(obj, *monitor.Options.EscalationMessage)
+			message, err := applyTemplateToField(obj, *monitor.Options.EscalationMessage, funcs)
 			if err != nil {
 				return err
 			}
@@ -136,40 +323,62 @@ func applyTemplate(obj interface{}, monitor *ddapi.Monitor, event *config.Event)
 		cfg.OwnerTag,
 		fmt.Sprintf("astro:object_type:%s", event.ResourceType),
 		fmt.Sprintf("astro:resource:%s", event.Key))
+	if uid != "" {
+		monitor.Tags = append(monitor.Tags, config.UIDTagPrefix+uid)
+	}
 	return nil
 }
 
-func ancillaryVariables() map[string]interface{} {
+// ancillaryVariables returns the functions available to templates from rulesets, the rulesets the templates were
+// found in, so every template of an object sees the same cluster variables even if the rulesets are reloaded
+// meanwhile.  namespace is the namespace of the AstroMonitorSet the templates came from, which lookup is limited to,
+// or empty for rulesets from the configuration.
+func ancillaryVariables(rulesets *config.Ruleset, namespace string) map[string]interface{} {
 	return map[string]interface{}{
-		"ClusterVariables": func() map[string]string { return config.GetInstance().Rulesets.ClusterVariables },
+		"ClusterVariables": func() map[string]string { return rulesets.ClusterVariables },
+		"scheduleWindow":   scheduleWindow,
+		"lookup":           namespacedLookup(namespace),
 	}
 }
 
 func parseOverrides(obj interface{}) map[string][]config.Override {
 	overrides := make(map[string][]config.Override)
-	switch obj.(type) {
+	var annotations map[string]string
+	switch object := obj.(type) {
 	case *appsv1.Deployment:
-		obj = obj.(*appsv1.Deployment)
-		for key, value := range obj.(*appsv1.Deployment).Annotations {
-			if isOverride(key) {
-				overrideName, overrideKind := parseOverrideKey(key)
-				thisOverride := config.Override{
-					Field: overrideKind,
-					Value: value,
-				}
-				overrides[overrideName] = append(overrides[overrideName], thisOverride)
-			}
-		}
+		annotations = object.Annotations
+	case *appsv1.StatefulSet:
+		annotations = object.Annotations
+	case *appsv1.DaemonSet:
+		annotations = object.Annotations
+	case *batchv1beta1.CronJob:
+		annotations = object.Annotations
+	case *batchv1.Job:
+		annotations = object.Annotations
 	case *corev1.Namespace:
-		for key, value := range obj.(*corev1.Namespace).Annotations {
-			if isOverride(key) {
-				overrideName, overrideKind := parseOverrideKey(key)
-				thisOverride := config.Override{
-					Field: overrideKind,
-					Value: value,
-				}
-				overrides[overrideName] = append(overrides[overrideName], thisOverride)
+		annotations = object.Annotations
+	case *networkingv1.Ingress:
+		annotations = object.Annotations
+	case *corev1.Service:
+		annotations = object.Annotations
+	case *autoscalingv1.HorizontalPodAutoscaler:
+		annotations = object.Annotations
+	case *VolumeClaim:
+		annotations = object.Annotations
+	case *NodePool:
+		annotations = object.Annotations
+	case *unstructured.Unstructured:
+		annotations = object.GetAnnotations()
+	}
+
+	for key, value := range annotations {
+		if isOverride(key) {
+			overrideName, overrideKind := parseOverrideKey(key)
+			thisOverride := config.Override{
+				Field: overrideKind,
+				Value: value,
 			}
+			overrides[overrideName] = append(overrides[overrideName], thisOverride)
 		}
 	}
 	return overrides
@@ -1,21 +1,27 @@
 package handler
 
 import (
+	"context"
 	"sort"
 	"testing"
 
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	ddapi "github.com/zorkian/go-datadog-api"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
 )
 
 func TestApplyTemplate(t *testing.T) {
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "foo",
+			UID:  "0a1b2c",
 		},
 	}
 	nameTemplate := "Name {{ .ObjectMeta.Name }}"
@@ -38,13 +44,31 @@ func TestApplyTemplate(t *testing.T) {
 		Namespace:    "c",
 		ResourceType: "d",
 	}
-	err := applyTemplate(deployment, &monitor, &event)
+	err := applyTemplate(deployment, &monitor, &event, ancillaryVariables(&config.Ruleset{}, ""))
 	assert.Equal(t, nil, err, "Error should be nil")
 	assert.Equal(t, "Name foo", *monitor.Name, "Name template should be filled")
 	assert.Equal(t, "Query foo", *monitor.Query, "Query template should be filled")
 	assert.Equal(t, "Message foo", *monitor.Message, "Message template should be filled")
 	assert.Equal(t, "EM foo", *monitor.Options.EscalationMessage, "EM template should be filled")
-	assert.Equal(t, []string{"test:foo", "astro", "astro:object_type:d", "astro:resource:a"}, monitor.Tags, "Tags template should be filled")
+	assert.Equal(t, []string{"test:foo", "astro", "astro:object_type:d", "astro:resource:a", "astro:uid:0a1b2c"}, monitor.Tags, "Tags template should be filled")
+}
+
+func TestApplyTemplateClusterVariables(t *testing.T) {
+	// cluster variables come from the rulesets the monitor was found in, not the rulesets in use when it's templated.
+	rulesets := &config.Ruleset{ClusterVariables: map[string]string{"env": "staging"}}
+	query := "avg:replicas{env:{{ ClusterVariables.env }}}"
+	monitor := ddapi.Monitor{Query: &query}
+	event := config.Event{Key: "foo/bar", EventType: "update", ResourceType: "deployment"}
+	err := applyTemplate(&appsv1.Deployment{}, &monitor, &event, ancillaryVariables(rulesets, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "avg:replicas{env:staging}", *monitor.Query)
+}
+
+func TestValidateTemplate(t *testing.T) {
+	assert.NoError(t, ValidateTemplate(`max(last_{{ scheduleWindow .Spec.Schedule }}m) {{ ClusterVariables.env }}`))
+	assert.NoError(t, ValidateTemplate(`{{ with lookup "Service" .ObjectMeta.Namespace .ObjectMeta.Name }}{{ .Spec.Type }}{{ end }}`))
+	assert.Error(t, ValidateTemplate("{{ .ObjectMeta.Name }"))
+	assert.Error(t, ValidateTemplate("{{ replicas .Spec }}"))
 }
 
 func TestParseOverrides(t *testing.T) {
@@ -73,3 +97,104 @@ func TestParseOverrides(t *testing.T) {
 			{Field: "threshold-warning", Value: "5.0"}}, overrides[k])
 	}
 }
+
+func TestParseOverridesStatefulSet(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+			Annotations: map[string]string{
+				"astro.fairwinds.com/override.sts-monitor.query": "avg(last_5m):foo{*} > 1",
+				"unrelated": "annotation",
+			},
+		},
+	}
+	overrides := parseOverrides(sts)
+	assert.Equal(t, map[string][]config.Override{
+		"sts-monitor": {{Field: "query", Value: "avg(last_5m):foo{*} > 1"}},
+	}, overrides)
+}
+
+func TestOnUpdateLabelsChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "foo",
+			Annotations: map[string]string{"astro/owner": "astro"},
+			Labels:      map[string]string{"tier": "web"},
+		},
+	}
+	oldMeta := dep.ObjectMeta
+	event := config.Event{
+		EventType:    "update",
+		Key:          "foo/foo",
+		Namespace:    "foo",
+		ResourceType: "deployment",
+		OldMeta:      &oldMeta,
+		NewMeta:      &dep.ObjectMeta,
+	}
+
+	// nothing that rulesets match on has changed, so Datadog isn't called
+	OnUpdate(context.TODO(), dep, event)
+
+	oldMeta.Labels = map[string]string{"tier": "api"}
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall)
+
+	OnUpdate(context.TODO(), dep, event)
+}
+
+func TestOnUpdateResync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "foo",
+			Annotations: map[string]string{"astro/owner": "astro"},
+		},
+	}
+	// resync events have no metadata, since the object itself hasn't changed.
+	event := config.Event{
+		EventType:    "resync",
+		Key:          "foo/foo",
+		Namespace:    "foo",
+		ResourceType: "deployment",
+	}
+
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall)
+
+	OnUpdate(context.TODO(), dep, event)
+}
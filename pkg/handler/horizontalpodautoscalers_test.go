@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func TestHorizontalPodAutoscalerChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	annotations := make(map[string]string, 1)
+	annotations["astro/owner"] = "astro"
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Annotations: annotations,
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			MaxReplicas: 10,
+		},
+	}
+	kubeClient.Client.AutoscalingV1().HorizontalPodAutoscalers("foo").Create(context.TODO(), hpa, metav1.CreateOptions{})
+	event := config.Event{
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "horizontalpodautoscaler",
+	}
+
+	tags := []string{"astro"}
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), tags, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Contains(t, *monitor.Query, ">= 10")
+		})
+
+	OnHorizontalPodAutoscalerChanged(context.TODO(), hpa, event)
+}
+
+func TestHorizontalPodAutoscalerChangeNoMatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	annotations := make(map[string]string, 1)
+	annotations["astro/owner"] = "not-astro"
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Annotations: annotations,
+		},
+	}
+	kubeClient.Client.AutoscalingV1().HorizontalPodAutoscalers("foo").Create(context.TODO(), hpa, metav1.CreateOptions{})
+	event := config.Event{
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "horizontalpodautoscaler",
+	}
+
+	// Don't expect any calls to Datadog
+
+	OnHorizontalPodAutoscalerChanged(context.TODO(), hpa, event)
+}
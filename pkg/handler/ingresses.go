@@ -0,0 +1,238 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	ddapi "github.com/zorkian/go-datadog-api"
+	networkingv1 "k8s.io/api/networking/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/metrics"
+)
+
+// An IngressPath is a single host and path served by an ingress.  Synthetics tests are templated against an
+// IngressPath, which also exposes the fields of the ingress, eg {{ .ObjectMeta.Name }}.
+type IngressPath struct {
+	*networkingv1.Ingress
+	Host string // The host of the ingress rule.
+	Path string // The path of the ingress rule.
+	URL  string // The URL the host and path are served on.
+}
+
+// OnIngressChanged is a handler that should be called when an ingress changes.
+// Along with monitors, ingress rulesets manage a synthetics test for every host and path of the ingress.
+func OnIngressChanged(ctx context.Context, ingress *networkingv1.Ingress, event config.Event) {
+	onObjectChanged(ctx, ingress, ingress.Annotations, ingress.Labels, event, "ingresses")
+
+	cfg := config.GetInstance()
+	dd := datadog.GetInstance()
+	tags := []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)}
+
+	switch strings.ToLower(event.EventType) {
+	case "delete":
+		if cfg.DryRun == false {
+			log.Debug("Deleting resource synthetics tests.")
+			metrics.ChangeCounter.WithLabelValues("synthetics", "delete").Inc()
+			dd.DeleteSyntheticsTests(ctx, tags)
+		}
+	case "create", "update":
+		var record []ddapi.SyntheticsTest
+		ns, err := getNamespace(ctx, event.Namespace)
+		if err != nil {
+			log.Errorf("Error getting namespace %s: %+v", event.Namespace, err)
+			return
+		}
+		var provisioned []ddapi.SyntheticsTest
+		if cfg.DryRun == false {
+			// the tests of the ingress are listed once and matched against every test templated below.
+			provisioned, err = dd.GetProvisionedSyntheticsTests(ctx, tags)
+			if err != nil {
+				metrics.ErrorCounter.Inc()
+				log.Errorf("Error getting synthetics tests of %s: %v", event.Key, err)
+				return
+			}
+		}
+		rulesets := cfg.Rulesets()
+		mSets := rulesets.GetMatchingMonitorSets(ingress.Annotations, ingress.Labels, ns, event.ResourceType, nil)
+		for _, path := range ingressPaths(ingress) {
+			for _, mSet := range mSets {
+				funcs := ancillaryVariables(rulesets, mSet.Namespace)
+				for _, tmpl := range mSet.Synthetics {
+					// every path is templated from its own copy of the ruleset's test
+					test, err := copySyntheticsTest(tmpl)
+					if err != nil {
+						log.Errorf("Error copying synthetics test: %v", err)
+						return
+					}
+					err = applySyntheticsTemplate(path, &test, tags, funcs)
+					if err != nil {
+						metrics.TemplateErrorCounter.Inc()
+						log.Errorf("Error applying template for synthetics test %s: %v", *tmpl.Name, err)
+						return
+					}
+					log.Debugf("Reconcile synthetics test %s", *test.Name)
+					if cfg.DryRun == false {
+						_, err := dd.AddOrUpdateSyntheticsTest(ctx, &test, provisioned)
+						metrics.ChangeCounter.WithLabelValues("synthetics", "create_update").Inc()
+						record = append(record, test)
+						if err != nil {
+							metrics.ErrorCounter.Inc()
+							log.Errorf("Error adding/updating synthetics test")
+						}
+					} else {
+						log.Info("Running as DryRun, skipping DataDog update")
+					}
+				}
+			}
+		}
+
+		if strings.ToLower(event.EventType) == "update" && !cfg.DryRun {
+			// remove tests for hosts and paths that are no longer served, or rulesets that no longer match.
+			dd.DeleteExtinctSyntheticsTests(ctx, record, provisioned)
+		}
+	}
+}
+
+// ingressPaths returns every host and path served by an ingress.  Rules without a host can't be tested and are skipped.
+func ingressPaths(ingress *networkingv1.Ingress) []IngressPath {
+	tlsHosts := make(map[string]bool)
+	for _, tls := range ingress.Spec.TLS {
+		for _, host := range tls.Hosts {
+			tlsHosts[host] = true
+		}
+	}
+
+	var paths []IngressPath
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host == "" {
+			continue
+		}
+		scheme := "http"
+		if tlsHosts[rule.Host] {
+			scheme = "https"
+		}
+		rulePaths := []string{"/"}
+		if rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+			rulePaths = nil
+			for _, path := range rule.HTTP.Paths {
+				rulePaths = append(rulePaths, path.Path)
+			}
+		}
+		for _, path := range rulePaths {
+			if path == "" {
+				path = "/"
+			}
+			paths = append(paths, IngressPath{
+				Ingress: ingress,
+				Host:    rule.Host,
+				Path:    path,
+				URL:     fmt.Sprintf("%s://%s%s", scheme, rule.Host, path),
+			})
+		}
+	}
+	return paths
+}
+
+func applySyntheticsTemplate(path IngressPath, test *ddapi.SyntheticsTest, tags []string, funcs map[string]interface{}) error {
+	if test.Name != nil {
+		name, err := applyTemplateToField(path, *test.Name, funcs)
+		if err != nil {
+			return err
+		}
+		test.Name = &name
+	}
+
+	if test.Message != nil {
+		message, err := applyTemplateToField(path, *test.Message, funcs)
+		if err != nil {
+			return err
+		}
+		test.Message = &message
+	}
+
+	for i, tag := range test.Tags {
+		tag, err := applyTemplateToField(path, tag, funcs)
+		if err != nil {
+			return err
+		}
+		test.Tags[i] = tag
+	}
+
+	for i, location := range test.Locations {
+		location, err := applyTemplateToField(path, location, funcs)
+		if err != nil {
+			return err
+		}
+		test.Locations[i] = location
+	}
+
+	if test.Type == nil {
+		test.SetType("api")
+	}
+	if test.Subtype == nil && test.GetType() == "api" {
+		test.SetSubtype("http")
+	}
+	if test.Config == nil {
+		test.Config = &ddapi.SyntheticsConfig{}
+	}
+	if test.Config.Request == nil {
+		test.Config.Request = &ddapi.SyntheticsRequest{}
+	}
+	if test.Config.Request.Method == nil {
+		test.Config.Request.SetMethod("GET")
+	}
+	url := path.URL
+	if test.Config.Request.Url != nil {
+		var err error
+		url, err = applyTemplateToField(path, *test.Config.Request.Url, funcs)
+		if err != nil {
+			return err
+		}
+	}
+	test.Config.Request.Url = &url
+
+	for i, assertion := range test.Config.Assertions {
+		if target, ok := assertion.Target.(string); ok {
+			target, err := applyTemplateToField(path, target, funcs)
+			if err != nil {
+				return err
+			}
+			test.Config.Assertions[i].Target = target
+		}
+	}
+
+	// apply identifying tags.  Tests are identified by the host and path they test, so tests whose names are the same
+	// are told apart.
+	test.Tags = append(test.Tags, tags...)
+	test.Tags = append(test.Tags, config.HostTagPrefix+config.TagValue(path.Host), config.PathTagPrefix+config.TagValue(path.Path))
+	return nil
+}
+
+func copySyntheticsTest(test ddapi.SyntheticsTest) (ddapi.SyntheticsTest, error) {
+	var copied ddapi.SyntheticsTest
+	data, err := json.Marshal(test)
+	if err != nil {
+		return copied, err
+	}
+	err = json.Unmarshal(data, &copied)
+	return copied, err
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func newTestIngress() *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "foo",
+			Annotations: map[string]string{"astro/owner": "astro"},
+		},
+		Spec: networkingv1.IngressSpec{
+			TLS: []networkingv1.IngressTLS{
+				{Hosts: []string{"secure.example.com"}},
+			},
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: "secure.example.com",
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{{Path: "/"}, {Path: "/api"}},
+						},
+					},
+				},
+				{Host: "www.example.com"},
+				{},
+			},
+		},
+	}
+}
+
+func TestIngressPaths(t *testing.T) {
+	var urls []string
+	for _, path := range ingressPaths(newTestIngress()) {
+		urls = append(urls, path.URL)
+	}
+	assert.Equal(t, []string{"https://secure.example.com/", "https://secure.example.com/api", "http://www.example.com/"}, urls)
+}
+
+func TestIngressChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	event := config.Event{
+		Key:          "foo/web",
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "ingress",
+	}
+
+	var created []string
+	ddMock.
+		EXPECT().
+		GetSyntheticsTests(gomock.Any()).
+		Times(1)
+	ddMock.
+		EXPECT().
+		CreateSyntheticsTest(gomock.Any(), gomock.Any()).
+		Times(3).
+		Do(func(_ context.Context, test *ddapi.SyntheticsTest) {
+			created = append(created, *test.Name)
+			assert.Equal(t, "api", *test.Type)
+			assert.Equal(t, "GET", *test.Config.Request.Method)
+			assert.Contains(t, *test.Message, *test.Config.Request.Url+" served by web is down")
+			assert.Contains(t, test.Tags, "ingress:web")
+			assert.Contains(t, test.Tags, "astro:resource:foo/web")
+			assert.Contains(t, test.Tags, "astro:synthetics:ingress-up")
+			if *test.Name == "Ingress Up - secure.example.com/api" {
+				// tests are identified by the host and path they test.
+				assert.Contains(t, test.Tags, "astro:host:secure.example.com")
+				assert.Contains(t, test.Tags, "astro:path:/api")
+			}
+		})
+
+	OnIngressChanged(context.TODO(), newTestIngress(), event)
+	assert.Equal(t, []string{"Ingress Up - secure.example.com/", "Ingress Up - secure.example.com/api", "Ingress Up - www.example.com/"}, created)
+}
+
+func TestIngressDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	event := config.Event{
+		Key:          "foo/web",
+		EventType:    "delete",
+		Namespace:    "foo",
+		ResourceType: "ingress",
+	}
+
+	tags := []string{"astro", "astro:object_type:ingress", "astro:resource:foo/web"}
+	name := "Ingress Up - www.example.com/"
+	ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		GetSyntheticsTests(gomock.Any()).
+		Return([]ddapi.SyntheticsTest{
+			{PublicId: ddapi.String("abc-123"), Name: &name, Tags: tags},
+			{PublicId: ddapi.String("def-456"), Name: &name, Tags: []string{"unmanaged"}},
+		}, nil)
+	ddMock.
+		EXPECT().
+		DeleteSyntheticsTests(gomock.Any(), []string{"abc-123"})
+
+	OnUpdate(context.TODO(), nil, event)
+}
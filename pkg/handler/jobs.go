@@ -0,0 +1,57 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+// OnJobChanged is a handler that should be called when a job changes.
+// Jobs created by a CronJob do not get monitors of their own, instead the parent CronJob is reconciled.
+func OnJobChanged(ctx context.Context, job *batchv1.Job, event config.Event) {
+	if owner := cronJobOwner(job); owner != "" {
+		if strings.ToLower(event.EventType) == "delete" {
+			// monitors belong to the cronjob, which outlives its jobs.
+			log.Debugf("Job %s is owned by cronjob %s, not deleting monitors.", event.Key, owner)
+			return
+		}
+		kubeClient := kube.GetInstance()
+		cronJob, err := kubeClient.Client.BatchV1beta1().CronJobs(job.Namespace).Get(ctx, owner, metav1.GetOptions{})
+		if err != nil {
+			log.Errorf("Error getting cronjob %s/%s owning job %s: %v", job.Namespace, owner, job.Name, err)
+			return
+		}
+		log.Debugf("Job %s is owned by cronjob %s, reconciling the cronjob instead.", event.Key, owner)
+		OnCronJobChanged(ctx, cronJob, setupBoundEvent(cronJob))
+		return
+	}
+	onObjectChanged(ctx, job, job.Annotations, job.Labels, event, "jobs")
+}
+
+// cronJobOwner returns the name of the CronJob controlling a job, or an empty string if there isn't one.
+func cronJobOwner(job *batchv1.Job) string {
+	if owner := metav1.GetControllerOf(job); owner != nil && owner.Kind == "CronJob" {
+		return owner.Name
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+var lookupIndexers = make(map[string]cache.Indexer)
+var lookupMux sync.RWMutex
+
+// RegisterLookup makes the objects in an informer's cache available to templates through the lookup function.
+// objectType is the ruleset type of the objects, eg deployment.
+func RegisterLookup(objectType string, indexer cache.Indexer) {
+	lookupMux.Lock()
+	defer lookupMux.Unlock()
+	lookupIndexers[objectType] = indexer
+}
+
+// UnregisterLookup stops lookup from finding objects of objectType, once they are no longer watched.
+func UnregisterLookup(objectType string) {
+	lookupMux.Lock()
+	defer lookupMux.Unlock()
+	delete(lookupIndexers, objectType)
+}
+
+// lookup returns the object of kind with the namespace and name specified, or nil if it doesn't exist.
+// kind is matched case insensitively against ruleset types, so "HorizontalPodAutoscaler" finds horizontalpodautoscaler
+// objects.  Cluster scoped objects are found with an empty namespace.
+func lookup(kind string, namespace string, name string) (interface{}, error) {
+	lookupMux.RLock()
+	indexer, found := lookupIndexers[kind]
+	if !found {
+		indexer, found = lookupIndexers[strings.ToLower(kind)]
+	}
+	lookupMux.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("objects of kind %s are not watched", kind)
+	}
+
+	key := name
+	if namespace != "" {
+		key = fmt.Sprintf("%s/%s", namespace, name)
+	}
+	obj, exists, err := indexer.GetByKey(key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	if object, ok := obj.(*unstructured.Unstructured); ok {
+		return object.Object, nil
+	}
+	return obj, nil
+}
+
+// namespacedLookup returns lookup limited to objects in namespace, as used by rulesets from an AstroMonitorSet.  An
+// empty namespace doesn't limit lookup.
+func namespacedLookup(namespace string) func(string, string, string) (interface{}, error) {
+	if namespace == "" {
+		return lookup
+	}
+	return func(kind string, objectNamespace string, name string) (interface{}, error) {
+		if objectNamespace != namespace {
+			return nil, fmt.Errorf("objects outside namespace %s can't be looked up", namespace)
+		}
+		return lookup(kind, objectNamespace, name)
+	}
+}
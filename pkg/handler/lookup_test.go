@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+func TestLookup(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "foo",
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			MaxReplicas: 12,
+		},
+	}
+	assert.NoError(t, indexer.Add(hpa))
+	RegisterLookup("horizontalpodautoscaler", indexer)
+
+	obj, err := lookup("HorizontalPodAutoscaler", "foo", "web")
+	assert.NoError(t, err)
+	assert.Equal(t, hpa, obj)
+
+	obj, err = lookup("horizontalpodautoscaler", "foo", "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, obj)
+
+	_, err = lookup("Unwatched", "foo", "web")
+	assert.Error(t, err)
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "foo",
+		},
+	}
+	query, err := applyTemplateToField(dep, `{{ with lookup "HorizontalPodAutoscaler" .ObjectMeta.Namespace .ObjectMeta.Name }}{{ .Spec.MaxReplicas }}{{ else }}none{{ end }}`, ancillaryVariables(&config.Ruleset{}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "12", query)
+
+	dep.ObjectMeta.Name = "other"
+	query, err = applyTemplateToField(dep, `{{ with lookup "HorizontalPodAutoscaler" .ObjectMeta.Namespace .ObjectMeta.Name }}{{ .Spec.MaxReplicas }}{{ else }}none{{ end }}`, ancillaryVariables(&config.Ruleset{}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "none", query)
+
+	// rulesets from an AstroMonitorSet can only look up objects in its namespace.
+	dep.ObjectMeta.Name = "web"
+	query, err = applyTemplateToField(dep, `{{ with lookup "HorizontalPodAutoscaler" .ObjectMeta.Namespace .ObjectMeta.Name }}{{ .Spec.MaxReplicas }}{{ end }}`, ancillaryVariables(&config.Ruleset{}, "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "12", query)
+	_, err = applyTemplateToField(dep, `{{ lookup "HorizontalPodAutoscaler" "kube-system" "web" }}`, ancillaryVariables(&config.Ruleset{}, "foo"))
+	assert.Error(t, err)
+	_, err = applyTemplateToField(dep, `{{ lookup "node" "" "web" }}`, ancillaryVariables(&config.Ruleset{}, "foo"))
+	assert.Error(t, err)
+}
@@ -15,10 +15,12 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+	ddapi "github.com/zorkian/go-datadog-api"
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/fairwindsops/astro/pkg/config"
@@ -28,7 +30,7 @@ import (
 )
 
 // OnNamespaceChanged is a handler that should be called when a namespace chanages.
-func OnNamespaceChanged(namespace *corev1.Namespace, event config.Event) {
+func OnNamespaceChanged(ctx context.Context, namespace *corev1.Namespace, event config.Event) {
 	cfg := config.GetInstance()
 	dd := datadog.GetInstance()
 	overrides := parseOverrides(namespace)
@@ -38,37 +40,43 @@ func OnNamespaceChanged(namespace *corev1.Namespace, event config.Event) {
 		if cfg.DryRun == false {
 			log.Info("Deleting resource monitors.")
 			metrics.ChangeCounter.WithLabelValues("namespaces", "delete").Inc()
-			dd.DeleteMonitors([]string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)})
+			dd.DeleteMonitors(ctx, []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)})
 		}
 	case "create", "update":
-		var record []string
-		for _, monitor := range *cfg.GetMatchingMonitors(namespace.Annotations, event.ResourceType, overrides) {
-			err := applyTemplate(namespace, &monitor, &event)
-			if err != nil {
-				metrics.TemplateErrorCounter.Inc()
-				log.Errorf("Error applying template for monitor %s: %v", *monitor.Name, err)
-				return
-			}
-			log.Debugf("Reconcile monitor %s", *monitor.Name)
-			if cfg.DryRun == false {
-				metrics.ChangeCounter.WithLabelValues("namespaces", "create_update").Inc()
-				_, err = dd.AddOrUpdate(&monitor)
-				record = append(record, *monitor.Name)
+		var record []ddapi.Monitor
+		rulesets := cfg.Rulesets()
+		for _, mSet := range rulesets.GetMatchingMonitorSets(namespace.Annotations, namespace.Labels, namespace, event.ResourceType, overrides) {
+			funcs := ancillaryVariables(rulesets, mSet.Namespace)
+			for _, monitor := range mSet.Monitors {
+				err := applyTemplate(namespace, &monitor, &event, funcs)
 				if err != nil {
-					metrics.ErrorCounter.Inc()
-					log.Errorf("Error adding/updating monitor")
+					metrics.TemplateErrorCounter.Inc()
+					log.Errorf("Error applying template for monitor %s: %v", *monitor.Name, err)
+					return
+				}
+				log.Debugf("Reconcile monitor %s", *monitor.Name)
+				if cfg.DryRun == false {
+					metrics.ChangeCounter.WithLabelValues("namespaces", "create_update").Inc()
+					_, err = dd.AddOrUpdate(ctx, &monitor)
+					record = append(record, monitor)
+					if err != nil {
+						metrics.ErrorCounter.Inc()
+						log.Errorf("Error adding/updating monitor")
+					}
+				} else {
+					log.Info("Running as DryRun, skipping DataDog update")
 				}
-			} else {
-				log.Info("Running as DryRun, skipping DataDog update")
 			}
 		}
-		// Update any bound monitors for this namespace
-		kubeClient := kube.GetInstance()
-		updateBoundResources(namespace, kubeClient)
+		// Update any bound monitors for this namespace.  On a resync, the objects in it are resynced by their own
+		// watchers, at the resync rate.
+		if !event.Resync {
+			updateBoundResources(ctx, namespace, kube.GetInstance())
+		}
 		if strings.ToLower(event.EventType) == "update" && !cfg.DryRun {
 			// if there are any additional monitors, they should be removed.  This could happen if an object
 			// was previously monitored and now no longer is.
-			datadog.DeleteExtinctMonitors(record, []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)})
+			datadog.DeleteExtinctMonitors(ctx, record, []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)})
 		}
 	default:
 		log.Warnf("Update type %s is not valid, skipping.", event.EventType)
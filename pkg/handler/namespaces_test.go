@@ -37,13 +37,13 @@ func TestNamespaceChange(t *testing.T) {
 	tags := []string{"astro"}
 	getTagsCall := ddMock.
 		EXPECT().
-		GetMonitorsByMonitorTags(tags)
+		GetMonitorsPage(gomock.Any(), tags, 0, gomock.Any())
 	ddMock.
 		EXPECT().
-		CreateMonitor(gomock.Any()).
+		CreateMonitor(gomock.Any(), gomock.Any()).
 		After(getTagsCall)
 
-	OnNamespaceChanged(ns, event)
+	OnNamespaceChanged(context.TODO(), ns, event)
 }
 
 func TestNamespaceChangeNoMatch(t *testing.T) {
@@ -68,5 +68,5 @@ func TestNamespaceChangeNoMatch(t *testing.T) {
 
 	// Don't expect any calls to Datadog
 
-	OnNamespaceChanged(ns, event)
+	OnNamespaceChanged(context.TODO(), ns, event)
 }
@@ -0,0 +1,173 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+	"github.com/fairwindsops/astro/pkg/metrics"
+)
+
+// nodePoolLabels are the labels used by common providers to identify a node's pool.
+var nodePoolLabels = []string{
+	"cloud.google.com/gke-nodepool",
+	"eks.amazonaws.com/nodegroup",
+	"kubernetes.azure.com/agentpool",
+	"agentpool",
+	"kops.k8s.io/instancegroup",
+}
+
+// A NodePool is a group of nodes sharing the same pool label.  Node monitors are templated against a NodePool.
+type NodePool struct {
+	Name        string            // The name of the pool.
+	Label       string            // The node label identifying the pool.
+	Labels      map[string]string // Labels common to every node in the pool.
+	Annotations map[string]string // Annotations common to every node in the pool.
+	Nodes       []corev1.Node     // The nodes in the pool.
+}
+
+// OnNodeChanged is a handler that should be called when a node changes.
+// Monitors are managed once per node pool rather than for every node.
+func OnNodeChanged(ctx context.Context, node *corev1.Node, event config.Event) {
+	cfg := config.GetInstance()
+	dd := datadog.GetInstance()
+	kubeClient := kube.GetInstance()
+
+	label, name := nodePool(node.Labels, cfg.NodePoolLabel)
+	if name == "" {
+		log.Debugf("Node %s does not belong to a node pool, skipping.", node.Name)
+		return
+	}
+	// pools of different providers may share a name, so the pool is identified by its label and name.
+	event.Key = fmt.Sprintf("%s/%s", label, name)
+
+	nodes, err := poolNodes(ctx, kubeClient, label, name)
+	if err != nil {
+		log.Errorf("Error getting nodes in pool %s: %v", event.Key, err)
+		return
+	}
+
+	switch strings.ToLower(event.EventType) {
+	case "delete":
+		if len(nodes) > 0 {
+			log.Debugf("Node pool %s still has %d nodes, keeping monitors.", event.Key, len(nodes))
+			return
+		}
+		if cfg.DryRun == false {
+			log.Debugf("Last node in pool %s removed, deleting monitors.", event.Key)
+			metrics.ChangeCounter.WithLabelValues("nodes", "delete").Inc()
+			dd.DeleteMonitors(ctx, []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", event.Key)})
+		}
+	case "create", "update":
+		if cfg.DryRun == false {
+			// monitors of older versions of astro were identified by the pool name alone.
+			dd.DeleteMonitors(ctx, []string{cfg.OwnerTag, fmt.Sprintf("astro:object_type:%s", event.ResourceType), fmt.Sprintf("astro:resource:%s", name)})
+		}
+		pool := newNodePool(label, name, nodes)
+		overrides := parseOverrides(pool)
+		rulesets := cfg.Rulesets()
+		mSets := rulesets.GetMatchingMonitorSets(pool.Annotations, pool.Labels, nil, event.ResourceType, overrides)
+		reconcileMonitors(ctx, pool, rulesets, mSets, event, "nodes")
+	default:
+		log.Warnf("Update type %s is not valid, skipping.", event.EventType)
+	}
+}
+
+// poolNodes returns the nodes with the pool label set to name, ordered by name.  They are read from the cache of the
+// node watcher, so a reconcile doesn't list the nodes from the API, or listed from the API if nodes aren't watched.
+func poolNodes(ctx context.Context, kubeClient *kube.ClientInstance, label string, name string) ([]corev1.Node, error) {
+	lookupMux.RLock()
+	indexer, found := lookupIndexers["node"]
+	lookupMux.RUnlock()
+	if !found {
+		list, err := kubeClient.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", label, name),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return list.Items, nil
+	}
+
+	var nodes []corev1.Node
+	for _, obj := range indexer.List() {
+		if node, ok := obj.(*corev1.Node); ok && node.Labels[label] == name {
+			nodes = append(nodes, *node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
+
+// nodePool returns the pool label and pool name for a node with the given labels.  If poolLabel is empty,
+// the first well known pool label present is used.
+func nodePool(labels map[string]string, poolLabel string) (string, string) {
+	if poolLabel != "" {
+		return poolLabel, labels[poolLabel]
+	}
+	for _, label := range nodePoolLabels {
+		if name, found := labels[label]; found {
+			return label, name
+		}
+	}
+	return "", ""
+}
+
+// newNodePool builds a NodePool from its nodes.  Only labels and annotations shared by all nodes are kept, so
+// every node in the pool matches the same rulesets.
+func newNodePool(label string, name string, nodes []corev1.Node) *NodePool {
+	pool := &NodePool{
+		Name:  name,
+		Label: label,
+		Nodes: nodes,
+	}
+	for i, node := range nodes {
+		if i == 0 {
+			pool.Labels = copyMap(node.Labels)
+			pool.Annotations = copyMap(node.Annotations)
+			continue
+		}
+		intersectMap(pool.Labels, node.Labels)
+		intersectMap(pool.Annotations, node.Annotations)
+	}
+	return pool
+}
+
+func copyMap(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+// intersectMap removes any entries from m that do not have the same value in other.
+func intersectMap(m map[string]string, other map[string]string) {
+	for k, v := range m {
+		if val, found := other[k]; !found || val != v {
+			delete(m, k)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func newTestNode(name string, pool string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"cloud.google.com/gke-nodepool": pool,
+				"astro/monitored":               "true",
+				"kubernetes.io/hostname":        name,
+			},
+		},
+	}
+}
+
+func TestNodePool(t *testing.T) {
+	labels := map[string]string{
+		"eks.amazonaws.com/nodegroup": "workers",
+		"custom/pool":                 "custom",
+	}
+	label, name := nodePool(labels, "")
+	assert.Equal(t, "eks.amazonaws.com/nodegroup", label)
+	assert.Equal(t, "workers", name)
+
+	label, name = nodePool(labels, "custom/pool")
+	assert.Equal(t, "custom/pool", label)
+	assert.Equal(t, "custom", name)
+
+	_, name = nodePool(map[string]string{}, "")
+	assert.Equal(t, "", name)
+}
+
+func TestNewNodePool(t *testing.T) {
+	pool := newNodePool("cloud.google.com/gke-nodepool", "default", []corev1.Node{
+		*newTestNode("node-a", "default"),
+		*newTestNode("node-b", "default"),
+	})
+	assert.Equal(t, "default", pool.Name)
+	assert.Len(t, pool.Nodes, 2)
+	assert.Equal(t, map[string]string{
+		"cloud.google.com/gke-nodepool": "default",
+		"astro/monitored":               "true",
+	}, pool.Labels)
+}
+
+func TestNodeChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	// the nodes of the pool are read from the cache of the node watcher.
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range []*corev1.Node{newTestNode("node-a", "default"), newTestNode("node-b", "default"), newTestNode("node-c", "other")} {
+		indexer.Add(node)
+	}
+	RegisterLookup("node", indexer)
+	defer func() {
+		lookupMux.Lock()
+		delete(lookupIndexers, "node")
+		lookupMux.Unlock()
+	}()
+
+	// monitors identified by the pool name alone, by older versions of astro, are replaced.
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any()).
+		Return([]ddapi.Monitor{{Id: ddapi.Int(1), Tags: []string{"astro", "astro:object_type:node", "astro:resource:default"}}}, nil)
+	ddMock.
+		EXPECT().
+		DeleteMonitor(gomock.Any(), 1).
+		After(getTagsCall)
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Equal(t, "Nodes Not Ready - default", *monitor.Name)
+			assert.Contains(t, *monitor.Message, "2 nodes in pool default")
+			assert.Contains(t, monitor.Tags, "astro:resource:cloud.google.com/gke-nodepool/default")
+		})
+
+	OnNodeChanged(context.TODO(), newTestNode("node-a", "default"), config.Event{
+		Key:          "node-a",
+		EventType:    "create",
+		ResourceType: "node",
+	})
+}
+
+func TestNodeDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	remaining := newTestNode("node-b", "default")
+	kubeClient.Client.CoreV1().Nodes().Create(context.TODO(), remaining, metav1.CreateOptions{})
+
+	deleted := newTestNode("node-a", "default")
+	event := config.Event{
+		Key:          "node-a",
+		EventType:    "delete",
+		ResourceType: "node",
+		OldMeta:      &deleted.ObjectMeta,
+		NewMeta:      &metav1.ObjectMeta{},
+	}
+
+	// the pool still has a node, so nothing is deleted
+	OnUpdate(context.TODO(), nil, event)
+
+	kubeClient.Client.CoreV1().Nodes().Delete(context.TODO(), remaining.Name, metav1.DeleteOptions{})
+	ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any()).
+		Return([]ddapi.Monitor{{Id: ddapi.Int(1), Tags: []string{"astro", "astro:object_type:node", "astro:resource:cloud.google.com/gke-nodepool/default"}}}, nil)
+	ddMock.
+		EXPECT().
+		DeleteMonitor(gomock.Any(), 1)
+
+	event.Key = "node-b"
+	event.OldMeta = &remaining.ObjectMeta
+	OnUpdate(context.TODO(), nil, event)
+}
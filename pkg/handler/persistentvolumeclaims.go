@@ -0,0 +1,68 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+// VolumeClaim is a persistent volume claim as it is seen by monitor templates.  Resource lists are keyed by
+// plain strings so quantities can be referenced by name, eg {{ .Spec.Resources.Requests.storage }}.
+type VolumeClaim struct {
+	*corev1.PersistentVolumeClaim
+	Spec VolumeClaimSpec
+}
+
+// VolumeClaimSpec is the spec of a VolumeClaim.
+type VolumeClaimSpec struct {
+	corev1.PersistentVolumeClaimSpec
+	Resources VolumeClaimResources
+}
+
+// VolumeClaimResources holds the resource limits and requests of a VolumeClaim, formatted as quantities, eg 10Gi.
+type VolumeClaimResources struct {
+	Limits   map[string]string
+	Requests map[string]string
+}
+
+// OnPersistentVolumeClaimChanged is a handler that should be called when a persistent volume claim changes.
+func OnPersistentVolumeClaimChanged(ctx context.Context, pvc *corev1.PersistentVolumeClaim, event config.Event) {
+	onObjectChanged(ctx, newVolumeClaim(pvc), pvc.Annotations, pvc.Labels, event, "persistentvolumeclaims")
+}
+
+func newVolumeClaim(pvc *corev1.PersistentVolumeClaim) *VolumeClaim {
+	return &VolumeClaim{
+		PersistentVolumeClaim: pvc,
+		Spec: VolumeClaimSpec{
+			PersistentVolumeClaimSpec: pvc.Spec,
+			Resources: VolumeClaimResources{
+				Limits:   resourceStrings(pvc.Spec.Resources.Limits),
+				Requests: resourceStrings(pvc.Spec.Resources.Requests),
+			},
+		},
+	}
+}
+
+func resourceStrings(resources corev1.ResourceList) map[string]string {
+	out := make(map[string]string, len(resources))
+	for name, quantity := range resources {
+		out[string(name)] = quantity.String()
+	}
+	return out
+}
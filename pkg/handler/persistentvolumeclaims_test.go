@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func newTestPersistentVolumeClaim(namespace string, annotations map[string]string) *corev1.PersistentVolumeClaim {
+	storageClass := "standard"
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "data",
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse("10Gi"),
+				},
+			},
+		},
+	}
+}
+
+func TestPersistentVolumeClaimChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	pvc := newTestPersistentVolumeClaim("foo", map[string]string{"astro/owner": "astro"})
+	kubeClient.Client.CoreV1().PersistentVolumeClaims("foo").Create(context.TODO(), pvc, metav1.CreateOptions{})
+	event := config.Event{
+		EventType:    "create",
+		Key:          "foo/data",
+		Namespace:    "foo",
+		ResourceType: "persistentvolumeclaim",
+	}
+
+	tags := []string{"astro"}
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), tags, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Contains(t, *monitor.Message, "data (10Gi of standard) is over 90% full")
+		})
+
+	OnPersistentVolumeClaimChanged(context.TODO(), pvc, event)
+}
+
+func TestPersistentVolumeClaimBound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "volumes",
+			Annotations: map[string]string{"volumes": "monitored"},
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	pvc := newTestPersistentVolumeClaim("volumes", nil)
+	kubeClient.Client.CoreV1().PersistentVolumeClaims("volumes").Create(context.TODO(), pvc, metav1.CreateOptions{})
+
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Equal(t, "Bound Volume Usage High - data", *monitor.Name)
+		})
+
+	updateBoundResources(context.TODO(), ns, kubeClient)
+}
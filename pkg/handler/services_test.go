@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func TestServiceChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	annotations := make(map[string]string, 1)
+	annotations["astro/owner"] = "astro"
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Annotations: annotations,
+		},
+	}
+	kubeClient.Client.CoreV1().Services("foo").Create(context.TODO(), svc, metav1.CreateOptions{})
+	event := config.Event{
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "service",
+	}
+
+	tags := []string{"astro"}
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), tags, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall)
+
+	OnServiceChanged(context.TODO(), svc, event)
+}
+
+func TestServiceChangeNoMatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+
+	annotations := make(map[string]string, 1)
+	annotations["astro/owner"] = "not-astro"
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Annotations: annotations,
+		},
+	}
+	kubeClient.Client.CoreV1().Services("foo").Create(context.TODO(), svc, metav1.CreateOptions{})
+	event := config.Event{
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "service",
+	}
+
+	// Don't expect any calls to Datadog
+
+	OnServiceChanged(context.TODO(), svc, event)
+}
+
+func TestServiceChangeMatchAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	name := "Service Alert - {{ .ObjectMeta.Name }}"
+	cfg := config.GetInstance()
+	cfg.SetMonitorSet("matchall/services", config.MonitorSet{
+		ObjectType: "service",
+		MatchAll:   true,
+		Namespace:  "matchall",
+		Monitors:   map[string]ddapi.Monitor{"svc-alert": {Name: &name}},
+	})
+	defer cfg.DeleteMonitorSet("matchall/services")
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "matchall",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "matchall",
+		},
+	}
+	event := config.Event{
+		EventType:    "create",
+		Key:          "matchall/foo",
+		Namespace:    "matchall",
+		ResourceType: "service",
+		OldMeta:      &metav1.ObjectMeta{},
+		NewMeta:      &svc.ObjectMeta,
+	}
+
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Equal(t, "Service Alert - foo", *monitor.Name)
+		})
+
+	OnUpdate(context.TODO(), svc, event)
+
+	// ignored services don't match
+	svc.Annotations = map[string]string{config.IgnoreAnnotation: "true"}
+	OnUpdate(context.TODO(), svc, event)
+}
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"context"
+
 	log "github.com/sirupsen/logrus"
+	ddapi "github.com/zorkian/go-datadog-api"
 
 	"github.com/fairwindsops/astro/pkg/config"
 	"github.com/fairwindsops/astro/pkg/datadog"
@@ -9,14 +12,21 @@ import (
 )
 
 // StaticMonitorUpdate is a handler that should be called by the controller on a timer
-func StaticMonitorUpdate(event config.Event) {
+func StaticMonitorUpdate(ctx context.Context, event config.Event) {
 	var err error
-	var record []string
+	var record []ddapi.Monitor
 	cfg := config.GetInstance()
+	if !cfg.Loaded() {
+		// every static monitor would be deleted as extinct.
+		log.Warn("Rulesets haven't been loaded yet, not updating static monitors")
+		return
+	}
 	dd := datadog.GetInstance()
-	monitors := cfg.GetStaticMonitors()
+	rulesets := cfg.Rulesets()
+	monitors := rulesets.GetStaticMonitors()
+	funcs := ancillaryVariables(rulesets, "")
 	for _, monitor := range *monitors {
-		err = applyTemplate(nil, &monitor, &event)
+		err = applyTemplate(nil, &monitor, &event, funcs)
 		if err != nil {
 			metrics.TemplateErrorCounter.Inc()
 			log.Errorf("Error applying template for monitor %s: %v", *monitor.Name, err)
@@ -24,8 +34,8 @@ func StaticMonitorUpdate(event config.Event) {
 		}
 		log.Debugf("Reconcile static monitor %s", *monitor.Name)
 		if cfg.DryRun == false {
-			_, err = dd.AddOrUpdate(&monitor)
-			record = append(record, *monitor.Name)
+			_, err = dd.AddOrUpdate(ctx, &monitor)
+			record = append(record, monitor)
 			if err != nil {
 				metrics.ErrorCounter.Inc()
 				log.Errorf("Error adding/updating static monitor:%s", err)
@@ -39,7 +49,7 @@ func StaticMonitorUpdate(event config.Event) {
 	if !cfg.DryRun {
 		// if there are any additional monitors, they should be removed.  This could happen if an object
 		// was previously monitored and now no longer is.
-		err = datadog.DeleteExtinctMonitors(record, []string{cfg.OwnerTag, "astro:object_type:static"})
+		err = datadog.DeleteExtinctMonitors(ctx, record, []string{cfg.OwnerTag, "astro:object_type:static"})
 		if err != nil {
 			log.Errorf("Error deleting extinct static monitors:%s", err)
 		}
@@ -0,0 +1,29 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/fairwindsops/astro/pkg/config"
+)
+
+// OnUnstructuredChanged is a handler that should be called when an object watched through the dynamic client changes.
+// These are objects whose ruleset type is a group/version/kind, eg argoproj.io/v1alpha1/Rollout.
+func OnUnstructuredChanged(ctx context.Context, obj *unstructured.Unstructured, event config.Event) {
+	onObjectChanged(ctx, obj, obj.GetAnnotations(), obj.GetLabels(), event, event.ResourceType)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	ddapi "github.com/zorkian/go-datadog-api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/datadog"
+	"github.com/fairwindsops/astro/pkg/kube"
+)
+
+func TestUnstructuredChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kubeClient := kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+	}
+	kubeClient.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	rollout := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Rollout",
+			"metadata": map[string]interface{}{
+				"name":      "canary",
+				"namespace": "foo",
+				"annotations": map[string]interface{}{
+					"astro/owner": "astro",
+					"astro.fairwinds.com/override.rollout-degraded.threshold-critical": "2",
+				},
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(3),
+			},
+		},
+	}
+	event := config.Event{
+		Key:          "foo/canary",
+		EventType:    "create",
+		Namespace:    "foo",
+		ResourceType: "argoproj.io/v1alpha1/Rollout",
+	}
+
+	getTagsCall := ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any())
+	ddMock.
+		EXPECT().
+		CreateMonitor(gomock.Any(), gomock.Any()).
+		After(getTagsCall).
+		Do(func(_ context.Context, monitor *ddapi.Monitor) {
+			assert.Equal(t, "Rollout Degraded - canary", *monitor.Name)
+			assert.Contains(t, *monitor.Message, "with 3 desired replicas")
+			assert.Equal(t, "2", monitor.Options.Thresholds.Critical.String())
+			assert.Contains(t, monitor.Tags, "astro:object_type:argoproj.io/v1alpha1/Rollout")
+		})
+
+	OnUnstructuredChanged(context.TODO(), rollout, event)
+}
+
+func TestUnstructuredDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	kube.SetAndGetMock()
+	ddMock := datadog.GetMock(ctrl)
+	defer ctrl.Finish()
+
+	event := config.Event{
+		Key:          "foo/canary",
+		EventType:    "delete",
+		Namespace:    "foo",
+		ResourceType: "argoproj.io/v1alpha1/Rollout",
+	}
+
+	// Datadog returns tags in lower case.
+	ddMock.
+		EXPECT().
+		GetMonitorsPage(gomock.Any(), []string{"astro"}, 0, gomock.Any()).
+		Return([]ddapi.Monitor{{Id: ddapi.Int(1), Tags: []string{"astro", "astro:object_type:argoproj.io/v1alpha1/rollout", "astro:resource:foo/canary"}}}, nil)
+	ddMock.
+		EXPECT().
+		DeleteMonitor(gomock.Any(), 1)
+
+	OnUpdate(context.TODO(), nil, event)
+}
@@ -18,7 +18,11 @@ import (
 	"sync"
 
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	// Necessary blank import to allow auth for GKE, Azure, etc
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -26,7 +30,16 @@ import (
 
 // ClientInstance is a wrapper around the kubernetes interface for testing purposes
 type ClientInstance struct {
-	Client kubernetes.Interface
+	Client        kubernetes.Interface
+	DynamicClient dynamic.Interface    // Used to watch object types that astro has no typed client for.
+	RESTMapper    ResettableRESTMapper // Maps object kinds to the resources served by the API.
+}
+
+// A ResettableRESTMapper is a RESTMapper that caches the kinds served by the API.  Reset discards the cache, so kinds
+// installed since, such as by a new custom resource definition, are found.
+type ResettableRESTMapper interface {
+	meta.RESTMapper
+	Reset()
 }
 
 var kubeClient *ClientInstance
@@ -36,15 +49,13 @@ var once sync.Once
 func GetInstance() *ClientInstance {
 	once.Do(func() {
 		if kubeClient == nil {
-			kubeClient = &ClientInstance{
-				Client: getKubeClient(),
-			}
+			kubeClient = getKubeClient()
 		}
 	})
 	return kubeClient
 }
 
-func getKubeClient() kubernetes.Interface {
+func getKubeClient() *ClientInstance {
 	kubeConf, err := config.GetConfig()
 	if err != nil {
 		log.Fatalf("Error getting kubeconfig: %v", err)
@@ -53,5 +64,13 @@ func getKubeClient() kubernetes.Interface {
 	if err != nil {
 		log.Fatalf("Error creating kubernetes client: %v", err)
 	}
-	return clientset
+	dynamicClient, err := dynamic.NewForConfig(kubeConf)
+	if err != nil {
+		log.Fatalf("Error creating dynamic kubernetes client: %v", err)
+	}
+	return &ClientInstance{
+		Client:        clientset,
+		DynamicClient: dynamicClient,
+		RESTMapper:    restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+	}
 }
@@ -1,18 +1,41 @@
 package kube
 
 import (
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
 // SetAndGetMock sets the singleton's interface to use a fake ClientSet
 func SetAndGetMock() *ClientInstance {
 	kc := ClientInstance{
-		Client: fake.NewSimpleClientset(),
+		Client:        fake.NewSimpleClientset(),
+		DynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		RESTMapper:    &MockRESTMapper{DefaultRESTMapper: meta.NewDefaultRESTMapper(nil)},
 	}
 	SetInstance(kc)
 	return &kc
 }
 
+// MockRESTMapper is a RESTMapper with fixed mappings that counts how many times it is reset.
+type MockRESTMapper struct {
+	*meta.DefaultRESTMapper
+	resets int32
+}
+
+// Reset counts the reset.  The mappings are kept.
+func (m *MockRESTMapper) Reset() {
+	atomic.AddInt32(&m.resets, 1)
+}
+
+// Resets returns how many times the mapper has been reset.
+func (m *MockRESTMapper) Resets() int {
+	return int(atomic.LoadInt32(&m.resets))
+}
+
 // SetInstance allows the user to set the kubeClient singleton
 func SetInstance(kc ClientInstance) {
 	kubeClient = &kc
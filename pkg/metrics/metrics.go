@@ -42,6 +42,45 @@ var (
 		[]string{"object", "action"},
 	)
 
+	// DriftCounter counts monitors that were changed (changed) or deleted (missing) in Datadog outside of Astro
+	DriftCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "monitor_drift_total",
+			Help: "Number of times a monitor was found changed or deleted in Datadog and reverted",
+		},
+		[]string{"drift"},
+	)
+
+	// ConfigReloadErrorCounter counts reloads of the configuration that failed and kept the last loaded rulesets
+	ConfigReloadErrorCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "config_reload_errors_total",
+			Help: "Number of times reloading the configuration failed",
+		})
+
+	// ConfigReloadTimestamp is the time the configuration was last reloaded successfully
+	ConfigReloadTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_last_reload_success_timestamp_seconds",
+			Help: "Unix time the configuration was last reloaded successfully",
+		})
+
+	// DatadogRateLimitRemaining is the number of requests left in each Datadog API rate limit, as last reported by Datadog
+	DatadogRateLimitRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "datadog_rate_limit_remaining",
+			Help: "Number of requests remaining in the Datadog API rate limit",
+		},
+		[]string{"limit"},
+	)
+
+	// DatadogRetryCounter counts requests to the datadog api retried after a rate limit or server error
+	DatadogRetryCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "datadog_api_retries_total",
+			Help: "Number of requests to the datadog api retried after a rate limit or server error",
+		})
+
 	// DatadogErrCounter counts errors interacting with the datadog api
 	DatadogErrCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
@@ -55,4 +94,9 @@ func RegisterMetrics() {
 	prometheus.MustRegister(ErrorCounter)
 	prometheus.MustRegister(ChangeCounter)
 	prometheus.MustRegister(TemplateErrorCounter)
+	prometheus.MustRegister(ConfigReloadErrorCounter)
+	prometheus.MustRegister(ConfigReloadTimestamp)
+	prometheus.MustRegister(DriftCounter)
+	prometheus.MustRegister(DatadogRateLimitRemaining)
+	prometheus.MustRegister(DatadogRetryCounter)
 }
@@ -5,6 +5,7 @@
 package mock_datadog
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	go_datadog_api "github.com/zorkian/go-datadog-api"
 	reflect "reflect"
@@ -34,87 +35,146 @@ func (m *MockClientAPI) EXPECT() *MockClientAPIMockRecorder {
 }
 
 // CreateMonitor mocks base method
-func (m *MockClientAPI) CreateMonitor(arg0 *go_datadog_api.Monitor) (*go_datadog_api.Monitor, error) {
+func (m *MockClientAPI) CreateMonitor(ctx context.Context, monitor *go_datadog_api.Monitor) (*go_datadog_api.Monitor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateMonitor", arg0)
+	ret := m.ctrl.Call(m, "CreateMonitor", ctx, monitor)
 	ret0, _ := ret[0].(*go_datadog_api.Monitor)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateMonitor indicates an expected call of CreateMonitor
-func (mr *MockClientAPIMockRecorder) CreateMonitor(arg0 interface{}) *gomock.Call {
+func (mr *MockClientAPIMockRecorder) CreateMonitor(ctx, monitor interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMonitor", reflect.TypeOf((*MockClientAPI)(nil).CreateMonitor), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMonitor", reflect.TypeOf((*MockClientAPI)(nil).CreateMonitor), ctx, monitor)
 }
 
 // DeleteMonitor mocks base method
-func (m *MockClientAPI) DeleteMonitor(id int) error {
+func (m *MockClientAPI) DeleteMonitor(ctx context.Context, id int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteMonitor", id)
+	ret := m.ctrl.Call(m, "DeleteMonitor", ctx, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteMonitor indicates an expected call of DeleteMonitor
-func (mr *MockClientAPIMockRecorder) DeleteMonitor(id interface{}) *gomock.Call {
+func (mr *MockClientAPIMockRecorder) DeleteMonitor(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMonitor", reflect.TypeOf((*MockClientAPI)(nil).DeleteMonitor), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMonitor", reflect.TypeOf((*MockClientAPI)(nil).DeleteMonitor), ctx, id)
 }
 
-// GetMonitorsByMonitorTags mocks base method
-func (m *MockClientAPI) GetMonitorsByMonitorTags(tags []string) ([]go_datadog_api.Monitor, error) {
+// GetMonitorsPage mocks base method
+func (m *MockClientAPI) GetMonitorsPage(ctx context.Context, tags []string, page, pageSize int) ([]go_datadog_api.Monitor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMonitorsByMonitorTags", tags)
+	ret := m.ctrl.Call(m, "GetMonitorsPage", ctx, tags, page, pageSize)
 	ret0, _ := ret[0].([]go_datadog_api.Monitor)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetMonitorsByMonitorTags indicates an expected call of GetMonitorsByMonitorTags
-func (mr *MockClientAPIMockRecorder) GetMonitorsByMonitorTags(tags interface{}) *gomock.Call {
+// GetMonitorsPage indicates an expected call of GetMonitorsPage
+func (mr *MockClientAPIMockRecorder) GetMonitorsPage(ctx, tags, page, pageSize interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMonitorsByMonitorTags", reflect.TypeOf((*MockClientAPI)(nil).GetMonitorsByMonitorTags), tags)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMonitorsPage", reflect.TypeOf((*MockClientAPI)(nil).GetMonitorsPage), ctx, tags, page, pageSize)
 }
 
 // MuteMonitorScope mocks base method
-func (m *MockClientAPI) MuteMonitorScope(id int, muteMonitorScope *go_datadog_api.MuteMonitorScope) error {
+func (m *MockClientAPI) MuteMonitorScope(ctx context.Context, id int, muteMonitorScope *go_datadog_api.MuteMonitorScope) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "MuteMonitorScope", id, muteMonitorScope)
+	ret := m.ctrl.Call(m, "MuteMonitorScope", ctx, id, muteMonitorScope)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // MuteMonitorScope indicates an expected call of MuteMonitorScope
-func (mr *MockClientAPIMockRecorder) MuteMonitorScope(id, muteMonitorScope interface{}) *gomock.Call {
+func (mr *MockClientAPIMockRecorder) MuteMonitorScope(ctx, id, muteMonitorScope interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MuteMonitorScope", reflect.TypeOf((*MockClientAPI)(nil).MuteMonitorScope), id, muteMonitorScope)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MuteMonitorScope", reflect.TypeOf((*MockClientAPI)(nil).MuteMonitorScope), ctx, id, muteMonitorScope)
 }
 
 // UnmuteMonitor mocks base method
-func (m *MockClientAPI) UnmuteMonitor(id int) error {
+func (m *MockClientAPI) UnmuteMonitor(ctx context.Context, id int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UnmuteMonitor", id)
+	ret := m.ctrl.Call(m, "UnmuteMonitor", ctx, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UnmuteMonitor indicates an expected call of UnmuteMonitor
-func (mr *MockClientAPIMockRecorder) UnmuteMonitor(id interface{}) *gomock.Call {
+func (mr *MockClientAPIMockRecorder) UnmuteMonitor(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnmuteMonitor", reflect.TypeOf((*MockClientAPI)(nil).UnmuteMonitor), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnmuteMonitor", reflect.TypeOf((*MockClientAPI)(nil).UnmuteMonitor), ctx, id)
 }
 
 // UpdateMonitor mocks base method
-func (m *MockClientAPI) UpdateMonitor(arg0 *go_datadog_api.Monitor) error {
+func (m *MockClientAPI) UpdateMonitor(ctx context.Context, monitor *go_datadog_api.Monitor) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateMonitor", arg0)
+	ret := m.ctrl.Call(m, "UpdateMonitor", ctx, monitor)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateMonitor indicates an expected call of UpdateMonitor
-func (mr *MockClientAPIMockRecorder) UpdateMonitor(arg0 interface{}) *gomock.Call {
+func (mr *MockClientAPIMockRecorder) UpdateMonitor(ctx, monitor interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMonitor", reflect.TypeOf((*MockClientAPI)(nil).UpdateMonitor), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMonitor", reflect.TypeOf((*MockClientAPI)(nil).UpdateMonitor), ctx, monitor)
+}
+
+// CreateSyntheticsTest mocks base method
+func (m *MockClientAPI) CreateSyntheticsTest(ctx context.Context, syntheticsTest *go_datadog_api.SyntheticsTest) (*go_datadog_api.SyntheticsTest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSyntheticsTest", ctx, syntheticsTest)
+	ret0, _ := ret[0].(*go_datadog_api.SyntheticsTest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSyntheticsTest indicates an expected call of CreateSyntheticsTest
+func (mr *MockClientAPIMockRecorder) CreateSyntheticsTest(ctx, syntheticsTest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSyntheticsTest", reflect.TypeOf((*MockClientAPI)(nil).CreateSyntheticsTest), ctx, syntheticsTest)
+}
+
+// DeleteSyntheticsTests mocks base method
+func (m *MockClientAPI) DeleteSyntheticsTests(ctx context.Context, publicIds []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSyntheticsTests", ctx, publicIds)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSyntheticsTests indicates an expected call of DeleteSyntheticsTests
+func (mr *MockClientAPIMockRecorder) DeleteSyntheticsTests(ctx, publicIds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSyntheticsTests", reflect.TypeOf((*MockClientAPI)(nil).DeleteSyntheticsTests), ctx, publicIds)
+}
+
+// GetSyntheticsTests mocks base method
+func (m *MockClientAPI) GetSyntheticsTests(ctx context.Context) ([]go_datadog_api.SyntheticsTest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSyntheticsTests", ctx)
+	ret0, _ := ret[0].([]go_datadog_api.SyntheticsTest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSyntheticsTests indicates an expected call of GetSyntheticsTests
+func (mr *MockClientAPIMockRecorder) GetSyntheticsTests(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSyntheticsTests", reflect.TypeOf((*MockClientAPI)(nil).GetSyntheticsTests), ctx)
+}
+
+// UpdateSyntheticsTest mocks base method
+func (m *MockClientAPI) UpdateSyntheticsTest(ctx context.Context, publicId string, syntheticsTest *go_datadog_api.SyntheticsTest) (*go_datadog_api.SyntheticsTest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSyntheticsTest", ctx, publicId, syntheticsTest)
+	ret0, _ := ret[0].(*go_datadog_api.SyntheticsTest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateSyntheticsTest indicates an expected call of UpdateSyntheticsTest
+func (mr *MockClientAPIMockRecorder) UpdateSyntheticsTest(ctx, publicId, syntheticsTest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSyntheticsTest", reflect.TypeOf((*MockClientAPI)(nil).UpdateSyntheticsTest), ctx, publicId, syntheticsTest)
 }
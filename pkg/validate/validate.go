@@ -0,0 +1,465 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validate checks ruleset configuration files, and the overrides of Kubernetes manifests, without a cluster.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	ghodssyaml "github.com/ghodss/yaml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fairwindsops/astro/pkg/config"
+	"github.com/fairwindsops/astro/pkg/handler"
+)
+
+const overridePrefix = "astro.fairwinds.com/override."
+
+// definitions mirrors the top level of a ruleset configuration file.
+type definitions struct {
+	ClusterVariables map[string]string   `json:"cluster_variables"`
+	MonitorSets      []config.MonitorSet `json:"rulesets"`
+}
+
+// The fields of monitors and synthetics tests that are templated against each object, as paths of keys.  * is every
+// item of a list.
+var (
+	monitorTemplateFields = [][]string{
+		{"name"},
+		{"query"},
+		{"message"},
+		{"tags", "*"},
+		{"options", "escalation_message"},
+	}
+	syntheticTemplateFields = [][]string{
+		{"name"},
+		{"message"},
+		{"tags", "*"},
+		{"locations", "*"},
+		{"config", "request", "url"},
+		{"config", "assertions", "*", "target"},
+	}
+)
+
+var (
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	numberType      = reflect.TypeOf(json.Number(""))
+)
+
+// An Error is a problem found in a file.  Line is 0 when the problem isn't with a particular line.  Warnings are
+// problems astro tolerates when it loads the file.
+type Error struct {
+	File    string
+	Line    int
+	Message string
+	Warning bool
+}
+
+func (e Error) Error() string {
+	message := e.Message
+	if e.Warning {
+		message = "warning: " + message
+	}
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, message)
+}
+
+// HasErrors returns whether any of errs isn't a warning.
+func HasErrors(errs []Error) bool {
+	for _, err := range errs {
+		if !err.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+type document struct {
+	file string
+	root *yaml.Node
+}
+
+type validator struct {
+	errs              []Error
+	monitors          map[string]bool // The identifiers of every monitor defined in the files
+	hasRulesets       bool            // Whether any of the files define rulesets
+	customObjectTypes []string        // The group/version/kind object types AstroMonitorSets may use
+}
+
+// Files validates ruleset configuration files and Kubernetes manifests.  Documents with an apiVersion and kind are
+// manifests: their override annotations are checked against the monitors defined in the other files, and
+// AstroMonitorSets are validated like rulesets, allowing the group/version/kind types in customObjectTypes.  Every
+// other document is validated as a configuration file.
+func Files(paths []string, customObjectTypes []string) []Error {
+	v := &validator{monitors: make(map[string]bool), customObjectTypes: customObjectTypes}
+	var manifests []document
+	for _, path := range paths {
+		docs, err := readDocuments(path)
+		if err != nil {
+			v.errorf(path, nil, "%v", err)
+			continue
+		}
+		// the rulesets of a file are named as astro names them when it loads the file.  Which files are loaded
+		// together isn't known, so names are only checked within each file.
+		namer := config.NewRulesetNamer()
+		for _, doc := range docs {
+			if doc.root.Kind != yaml.MappingNode {
+				v.errorf(doc.file, doc.root, "expected a mapping")
+				continue
+			}
+			if field(doc.root, "apiVersion") != nil && field(doc.root, "kind") != nil {
+				manifests = append(manifests, doc)
+				if kind := field(doc.root, "kind"); kind.Value == "AstroMonitorSet" {
+					v.validateAstroMonitorSet(doc)
+				}
+				continue
+			}
+			v.validateDefinitions(doc, namer)
+		}
+	}
+	// overrides are checked last, so they can refer to monitors defined in any of the files.
+	for _, doc := range manifests {
+		v.validateOverrides(doc)
+	}
+	return v.errs
+}
+
+func readDocuments(path string) ([]document, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var docs []document
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue
+		}
+		docs = append(docs, document{file: path, root: node.Content[0]})
+	}
+}
+
+func (v *validator) errorf(file string, node *yaml.Node, format string, args ...interface{}) {
+	err := Error{File: file, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		err.Line = node.Line
+	}
+	v.errs = append(v.errs, err)
+}
+
+func (v *validator) warnf(file string, node *yaml.Node, format string, args ...interface{}) {
+	v.errorf(file, node, format, args...)
+	v.errs[len(v.errs)-1].Warning = true
+}
+
+func (v *validator) validateDefinitions(doc document, namer *config.RulesetNamer) {
+	v.hasRulesets = true
+	// astro ignores unknown keys at the top level, such as notification_profiles from older configuration files.
+	fields := jsonFields(reflect.TypeOf(definitions{}))
+	for i := 0; i+1 < len(doc.root.Content); i += 2 {
+		key := doc.root.Content[i]
+		if fieldType, found := fields[key.Value]; found {
+			v.checkSchema(doc.file, doc.root.Content[i+1], fieldType)
+		} else {
+			v.warnf(doc.file, key, "unknown field %q is ignored", key.Value)
+		}
+	}
+	rulesets := field(doc.root, "rulesets")
+	if rulesets == nil || rulesets.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, node := range rulesets.Content {
+		mSet := decodeMonitorSet(node)
+		for _, err := range mSet.Validate() {
+			v.errorf(doc.file, node, "%v", err)
+		}
+		if err := namer.Add(&mSet); err != nil {
+			v.errorf(doc.file, node, "%v", err)
+		}
+		v.validateMonitors(doc.file, node, mSet.ObjectType)
+	}
+}
+
+func (v *validator) validateAstroMonitorSet(doc document) {
+	v.hasRulesets = true
+	spec := field(doc.root, "spec")
+	if spec == nil {
+		v.errorf(doc.file, doc.root, "AstroMonitorSet has no spec")
+		return
+	}
+	v.checkSchema(doc.file, spec, reflect.TypeOf(config.MonitorSet{}))
+	mSet := decodeMonitorSet(spec)
+	// the scope of object types can't be checked without a cluster.
+	for _, err := range mSet.ValidateCustom(v.customObjectTypes, nil) {
+		v.errorf(doc.file, spec, "%v", err)
+	}
+	v.validateMonitors(doc.file, spec, mSet.ObjectType)
+}
+
+// validateMonitors parses the templated fields of a ruleset's monitors and synthetics tests, and records the
+// identifiers of its monitors.
+func (v *validator) validateMonitors(file string, mSet *yaml.Node, objectType string) {
+	if monitors := field(mSet, "monitors"); monitors != nil && monitors.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(monitors.Content); i += 2 {
+			name := monitors.Content[i].Value
+			v.monitors[name] = true
+			if objectType != "static" {
+				// static monitors aren't templated.
+				v.validateTemplates(file, "monitor "+name, monitors.Content[i+1], monitorTemplateFields)
+			}
+		}
+	}
+	if synthetics := field(mSet, "synthetics"); synthetics != nil && synthetics.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(synthetics.Content); i += 2 {
+			v.validateTemplates(file, "synthetics test "+synthetics.Content[i].Value, synthetics.Content[i+1], syntheticTemplateFields)
+		}
+	}
+}
+
+func (v *validator) validateTemplates(file string, name string, node *yaml.Node, fields [][]string) {
+	for _, path := range fields {
+		for _, value := range find(node, path) {
+			if value.Kind != yaml.ScalarNode || value.Tag != "!!str" {
+				continue
+			}
+			if err := handler.ValidateTemplate(value.Value); err != nil {
+				v.errorf(file, value, "%s has an invalid template in %s: %v", name, strings.Trim(strings.Join(path, "."), ".*"), err)
+			}
+		}
+	}
+}
+
+func (v *validator) validateOverrides(doc document) {
+	annotations := field(field(doc.root, "metadata"), "annotations")
+	if annotations == nil || annotations.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(annotations.Content); i += 2 {
+		key := annotations.Content[i]
+		if !strings.HasPrefix(key.Value, overridePrefix) {
+			continue
+		}
+		override := strings.TrimPrefix(key.Value, overridePrefix)
+		separator := strings.LastIndex(override, ".")
+		if separator < 1 {
+			v.errorf(doc.file, key, "override %s must be in the form %s<monitor>.<field>", key.Value, overridePrefix)
+			continue
+		}
+		monitor, overrideField := override[:separator], override[separator+1:]
+		if !contains(config.OverrideFields, overrideField) {
+			v.errorf(doc.file, key, "override %s has unknown field %q, must be one of %s", key.Value, overrideField, strings.Join(config.OverrideFields, ", "))
+		} else if strings.HasPrefix(overrideField, "threshold-") {
+			if _, err := strconv.ParseFloat(annotations.Content[i+1].Value, 64); err != nil {
+				v.errorf(doc.file, annotations.Content[i+1], "override %s must be a number", key.Value)
+			}
+		}
+		if v.hasRulesets && !v.monitors[monitor] {
+			v.errorf(doc.file, key, "override %s refers to monitor %q, which isn't defined in any ruleset", key.Value, monitor)
+		}
+	}
+}
+
+// checkSchema reports fields of node that aren't in t, and values that can't be unmarshalled into their field.
+func (v *validator) checkSchema(file string, node *yaml.Node, t reflect.Type) {
+	node = resolve(node)
+	if node.Tag == "!!null" {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) || (t.Kind() != reflect.Struct && t.Kind() != reflect.Map && t.Kind() != reflect.Slice) {
+		if !decode(node, reflect.New(t).Interface()) {
+			if node.Kind == yaml.ScalarNode {
+				v.errorf(file, node, "%q is not %s", node.Value, describe(t))
+			} else {
+				v.errorf(file, node, "expected %s", describe(t))
+			}
+		}
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.errorf(file, node, "expected a mapping")
+			return
+		}
+		fields := jsonFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, found := fields[key.Value]
+			if !found {
+				v.errorf(file, key, "unknown field %q", key.Value)
+				continue
+			}
+			v.checkSchema(file, node.Content[i+1], fieldType)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.errorf(file, node, "expected a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.checkSchema(file, node.Content[i+1], t.Elem())
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.errorf(file, node, "expected a list")
+			return
+		}
+		for _, item := range node.Content {
+			v.checkSchema(file, item, t.Elem())
+		}
+	}
+}
+
+// jsonFields returns the types of the fields of struct type t, keyed by their json name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for k, v := range jsonFields(embedded) {
+					fields[k] = v
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// decode unmarshals node into out the way astro loads configuration files, returning whether it succeeded.
+func decode(node *yaml.Node, out interface{}) bool {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return false
+	}
+	return ghodssyaml.Unmarshal(data, out) == nil
+}
+
+// decodeMonitorSet unmarshals a ruleset.  When the schema check has found values that can't be unmarshalled, only its
+// type is decoded, so the type can still be validated.
+func decodeMonitorSet(node *yaml.Node) config.MonitorSet {
+	var mSet config.MonitorSet
+	if !decode(node, &mSet) {
+		mSet = config.MonitorSet{}
+		if objectType := field(node, "type"); objectType != nil {
+			mSet.ObjectType = objectType.Value
+		}
+	}
+	return mSet
+}
+
+func describe(t reflect.Type) string {
+	if t == numberType {
+		return "a number"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a valid " + t.String()
+}
+
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// field returns the value of key in a mapping node, or nil.
+func field(node *yaml.Node, key string) *yaml.Node {
+	node = resolve(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolve(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// find returns the values at path in node.
+func find(node *yaml.Node, path []string) []*yaml.Node {
+	node = resolve(node)
+	if node == nil {
+		return nil
+	}
+	if len(path) == 0 {
+		return []*yaml.Node{node}
+	}
+	if path[0] == "*" {
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		var found []*yaml.Node
+		for _, item := range node.Content {
+			found = append(found, find(item, path[1:])...)
+		}
+		return found
+	}
+	return find(field(node, path[0]), path[1:])
+}
+
+func contains(slice []string, key string) bool {
+	for _, s := range slice {
+		if s == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 FairwindsOps Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func errorStrings(errs []Error) []string {
+	var strs []string
+	for _, err := range errs {
+		strs = append(strs, err.Error())
+	}
+	return strs
+}
+
+func TestFilesValid(t *testing.T) {
+	errs := Files([]string{
+		"../../conf.yml",
+		"../../conf-example.yml",
+		"../../static_conf.yml",
+		"../config/test_conf.yml",
+		"../config/test_conf_variables.yml",
+	}, nil)
+	// keys astro ignores are only warned about.
+	assert.Equal(t, []string{`../config/test_conf.yml:2: warning: unknown field "notification_profiles" is ignored`}, errorStrings(errs))
+	assert.False(t, HasErrors(errs))
+}
+
+func TestFilesRulesets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-validate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "conf.yml", `rulesets:
+- type: deploymnt
+  match_annotation:
+    - name: astro/owner
+  monitors:
+    dep-replica-alert:
+      name: "Replica Alert - {{ .ObjectMeta.Name }"
+      query: "{{ replicas .Spec }}"
+      tags:
+        - "{{ ClusterVariables.env }}"
+      options:
+        notify_audit: maybe
+        thresholds:
+          critical: 0
+- type: static
+  monitors:
+    static-alert:
+      name: "Static Alert"
+      message: "{{#is_alert}}Alerting{{/is_alert}}"
+`)
+	assert.Equal(t, []string{
+		path + `:3: unknown field "match_annotation"`,
+		path + `:12: "maybe" is not a boolean`,
+		path + ":2: type deploymnt is not a known object type",
+		path + `:7: monitor dep-replica-alert has an invalid template in name: template: :1: unexpected "}" in operand`,
+		path + `:8: monitor dep-replica-alert has an invalid template in query: template: :1: function "replicas" not defined`,
+	}, errorStrings(Files([]string{path}, nil)))
+	assert.True(t, HasErrors(Files([]string{path}, nil)))
+}
+
+func TestFilesRulesetNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-validate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "conf.yml", `rulesets:
+- name: foo
+  type: deployment
+  match_all: true
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} replicas"
+- name: foo
+  type: statefulset
+  match_all: true
+  monitors:
+    replicas:
+      name: "{{ .ObjectMeta.Name }} replicas"
+- type: deployment
+  match_all: true
+  monitors:
+    pods:
+      name: "{{ .ObjectMeta.Name }} pods"
+- type: binding
+  bound_objects:
+    - deployment
+  monitors:
+    pods:
+      name: "{{ .ObjectMeta.Name }} bound pods"
+`)
+	// astro refuses to load rulesets it can't tell the monitors of apart.
+	assert.Equal(t, []string{
+		path + ":8: the name foo is already used",
+		path + ":19: monitor pods is also in another unnamed ruleset for deployment objects, so the rulesets must be named",
+	}, errorStrings(Files([]string{path}, nil)))
+}
+
+func TestFilesOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-validate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := writeFile(t, dir, "conf.yml", `rulesets:
+- type: deployment
+  match_annotations:
+    - name: astro/owner
+      value: astro
+  monitors:
+    dep-replica-alert:
+      name: "Replica Alert - {{ .ObjectMeta.Name }}"
+`)
+	manifest := writeFile(t, dir, "deployment.yml", `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+  annotations:
+    astro/owner: astro
+    astro.fairwinds.com/override.dep-replica-alert.name: "Foo Replica Alert"
+    astro.fairwinds.com/override.dep-replica-alert.thresholds: "1"
+    astro.fairwinds.com/override.dep-replica-alert.threshold-critical: "one"
+    astro.fairwinds.com/override.replica-alert.query: "avg(last_5m):avg:foo{*} > 1"
+`)
+	monitorSet := writeFile(t, dir, "monitorset.yml", `apiVersion: astro.fairwinds.com/v1alpha1
+kind: AstroMonitorSet
+metadata:
+  name: team
+spec:
+  type: node
+  monitors:
+    team-alert:
+      name: "Team Alert - {{ .Name }}"
+`)
+
+	assert.Equal(t, []string{
+		manifest + `:8: override astro.fairwinds.com/override.dep-replica-alert.thresholds has unknown field "thresholds", must be one of name, type, query, message, threshold-critical, threshold-warning`,
+		manifest + ":9: override astro.fairwinds.com/override.dep-replica-alert.threshold-critical must be a number",
+		manifest + `:10: override astro.fairwinds.com/override.replica-alert.query refers to monitor "replica-alert", which isn't defined in any ruleset`,
+	}, errorStrings(Files([]string{conf, manifest}, nil)))
+
+	// without any rulesets, the monitors overrides refer to can't be checked.
+	assert.Equal(t, 2, len(Files([]string{manifest}, nil)))
+
+	assert.Equal(t, []string{
+		monitorSet + ":6: type node can't be used in an AstroMonitorSet",
+	}, errorStrings(Files([]string{monitorSet}, nil)))
+
+	rollouts := writeFile(t, dir, "rollouts.yml", `apiVersion: astro.fairwinds.com/v1alpha1
+kind: AstroMonitorSet
+metadata:
+  name: rollouts
+spec:
+  type: argoproj.io/v1alpha1/Rollout
+  match_all: true
+  monitors:
+    rollout-degraded:
+      name: "Rollout Degraded - {{ .metadata.name }}"
+`)
+	assert.Equal(t, []string{
+		rollouts + ":6: type argoproj.io/v1alpha1/Rollout is not allowed in an AstroMonitorSet",
+	}, errorStrings(Files([]string{rollouts}, nil)))
+	assert.Empty(t, errorStrings(Files([]string{rollouts}, []string{"argoproj.io/v1alpha1/Rollout"})))
+}
+
+func TestFilesUnreadable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-validate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "conf.yml", "rulesets:\n  - type: deployment\n monitors: {}\n")
+	errs := Files([]string{path, filepath.Join(dir, "missing.yml")}, nil)
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, path, errs[0].File)
+	assert.Contains(t, errs[0].Message, "line 2")
+	assert.Equal(t, filepath.Join(dir, "missing.yml"), errs[1].File)
+}